@@ -0,0 +1,253 @@
+package goplugify
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// APIError is the error envelope written by the v2 routes:
+//
+//	{"error": {"code": "not_found", "message": "...", "details": ...}}
+type APIError struct {
+	Status  int       `json:"-"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	Details any       `json:"details,omitempty"`
+}
+
+func errMissingParam(name string) error {
+	return NewCodeError(CodeInvalidRequest, name+" is required")
+}
+
+// toAPIError maps err onto the status and code reported to HTTP clients.
+func toAPIError(err error) *APIError {
+	code := CodeOf(err)
+	return &APIError{
+		Status:  code.HTTPStatus(),
+		Code:    code,
+		Message: err.Error(),
+		Details: DetailsOf(err),
+	}
+}
+
+// WriteError writes err using the v2 error envelope.
+func WriteError(c HttpContext, err error) {
+	apiErr := toAPIError(err)
+	c.JSON(apiErr.Status, map[string]any{
+		"error": apiErr,
+	})
+}
+
+// HttpParamContext is implemented by contexts whose router supports path parameters.
+type HttpParamContext interface {
+	Param(key string) string
+}
+
+// PathParam returns the path parameter key, falling back to the query string for
+// routers that do not expose path parameters.
+func PathParam(c HttpContext, key string) string {
+	if pc, ok := c.(HttpParamContext); ok {
+		if value := pc.Param(key); value != "" {
+			return value
+		}
+	}
+	return c.Query(key)
+}
+
+// RegisterRoutesV2 registers the resource oriented management API. Path parameters
+// use the ":name" syntax understood by most Go routers.
+func (server *HTTPServer) RegisterRoutesV2(router HttpRouter, routePrefix string) {
+	if ew, ok := router.(ErrorWriterRouter); ok {
+		router = ew.WithErrorWriter(WriteError)
+	}
+	routes := []Route{
+		{Method: "GET", Path: "/plugins", Summary: "List plugins, paged with limit and cursor", Params: listParams, Response: "PluginList", Permissions: []Permission{PermList}, handler: server.listPluginsV2},
+		{Method: "GET", Path: "/plugins/:id", Summary: "Get a plugin", Response: "Plugin", Permissions: []Permission{PermList}, handler: server.getPluginV2},
+		{Method: "PUT", Path: "/plugins/:id", Summary: "Load or upgrade a plugin", Body: RouteBodyMultipart, Response: "Plugin", Permissions: []Permission{PermLoad}, ContentHash: true, handler: server.putPluginV2},
+		{Method: "DELETE", Path: "/plugins/:id", Summary: "Unload a plugin", Response: "Message", Permissions: []Permission{PermUnload}, handler: server.deletePluginV2},
+		{Method: "POST", Path: "/plugins/:id/run", Summary: "Run a plugin", Body: RouteBodyJSON, Permissions: []Permission{PermRun}, handler: server.runPluginV2},
+		{Method: "POST", Path: "/plugins/:id/methods/:name", Summary: "Call a method exported by a plugin", Body: RouteBodyJSON, Permissions: []Permission{PermRun}, handler: server.callMethodV2},
+	}
+	for i := range routes {
+		routes[i].Service = true
+		routes[i].ErrorFormat = ErrorFormatEnvelope
+	}
+	server.addRoutes(router, routePrefix, routes)
+}
+
+func (server *HTTPServer) getManager(c HttpContext) (Manager, error) {
+	serviceName := server.getService(c)
+	manager, ok := server.registry.Get(serviceName)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, serviceName)
+	}
+	return manager, nil
+}
+
+func (server *HTTPServer) getPluginOfPath(c HttpContext) (IPlugin, error) {
+	manager, err := server.getManager(c)
+	if err != nil {
+		return nil, err
+	}
+	pluginID := PathParam(c, "id")
+	if pluginID == "" {
+		return nil, errMissingParam("id")
+	}
+	return manager.GetPlugin(pluginID)
+}
+
+func (server *HTTPServer) listPluginsV2(c HttpContext) {
+	plugins, err := server.listPlugins(c)
+	if err != nil {
+		WriteError(c, err)
+		return
+	}
+	c.JSON(200, plugins)
+}
+
+func (server *HTTPServer) getPluginV2(c HttpContext) {
+	plugin, err := server.getPluginOfPath(c)
+	if err != nil {
+		WriteError(c, err)
+		return
+	}
+	c.JSON(200, plugin)
+}
+
+func (server *HTTPServer) putPluginV2(c HttpContext) {
+	manager, err := server.getManager(c)
+	if err != nil {
+		WriteError(c, err)
+		return
+	}
+	pluginID := PathParam(c, "id")
+	if pluginID == "" {
+		WriteError(c, errMissingParam("id"))
+		return
+	}
+	if err := checkContentLength(c, MaxArtifactSize(manager)); err != nil {
+		WriteError(c, err)
+		return
+	}
+
+	meta, err := parseMeta(c)
+	if err != nil {
+		WriteError(c, err)
+		return
+	}
+	if meta.ID == "" {
+		meta.ID = pluginID
+	}
+	if meta.ID != pluginID {
+		WriteError(c, NewCodeError(CodeInvalidMeta, fmt.Sprintf("meta id %s does not match plugin %s", meta.ID, pluginID)))
+		return
+	}
+
+	status := 201
+	if exist, err := manager.GetPlugin(pluginID); err == nil {
+		if exist.Meta().Loader != meta.Loader {
+			WriteError(c, WrapError(CodeConflict, "load", pluginID,
+				fmt.Errorf("loaded by %s and cannot be upgraded by %s", exist.Meta().Loader, meta.Loader)))
+			return
+		}
+		status = 200
+	}
+
+	plugin, err := manager.LoadPlugin(c, meta, c)
+	if err != nil {
+		WriteError(c, err)
+		return
+	}
+	c.JSON(status, plugin)
+}
+
+func (server *HTTPServer) deletePluginV2(c HttpContext) {
+	manager, err := server.getManager(c)
+	if err != nil {
+		WriteError(c, err)
+		return
+	}
+	pluginID := PathParam(c, "id")
+	if pluginID == "" {
+		WriteError(c, errMissingParam("id"))
+		return
+	}
+	if err := manager.UnloadPlugin(c, pluginID); err != nil {
+		WriteError(c, err)
+		return
+	}
+	c.JSON(200, map[string]any{
+		"message": "plugin unloaded",
+	})
+}
+
+func (server *HTTPServer) runPluginV2(c HttpContext) {
+	plugin, err := server.getPluginOfPath(c)
+	if err != nil {
+		WriteError(c, err)
+		return
+	}
+	req, err := server.newRunRequest(c, server.getService(c), plugin, TriggerHTTP)
+	if err != nil {
+		WriteError(c, err)
+		return
+	}
+	resp, err := plugin.OnRun(req)
+	if err != nil {
+		WriteError(c, WrapError(CodeRunFailed, "run", plugin.Meta().ID, err))
+		return
+	}
+	if err := writeRunResult(c, resp); err != nil {
+		WriteError(c, err)
+	}
+}
+
+func (server *HTTPServer) callMethodV2(c HttpContext) {
+	plugin, err := server.getPluginOfPath(c)
+	if err != nil {
+		WriteError(c, err)
+		return
+	}
+	name := PathParam(c, "name")
+	if name == "" {
+		WriteError(c, errMissingParam("name"))
+		return
+	}
+	method, ok := plugin.Method(name)
+	if !ok {
+		WriteError(c, WrapError(CodeNotFound, "call", plugin.Meta().ID, fmt.Errorf("method %s not found", name)))
+		return
+	}
+
+	body, err := readBody(c, server.maxBodySize())
+	if err != nil {
+		WriteError(c, err)
+		return
+	}
+	input, err := decodeInput(body)
+	if err != nil {
+		WriteError(c, err)
+		return
+	}
+	schema := plugin.Meta().Methods[name]
+	if err := checkSchema(schema.Input, input, CodeInvalidRequest, "input"); err != nil {
+		WriteError(c, WrapError(CodeInvalidRequest, "call "+name, plugin.Meta().ID, err))
+		return
+	}
+
+	output := method(input)
+	if len(schema.Output) > 0 {
+		// Round-trip the output so that it is checked the way clients will decode it.
+		data, err := json.Marshal(output)
+		if err != nil {
+			WriteError(c, WrapError(CodeInvalidOutput, "call "+name, plugin.Meta().ID, err))
+			return
+		}
+		decoded, _ := decodeInput(data)
+		if err := checkSchema(schema.Output, decoded, CodeInvalidOutput, "output"); err != nil {
+			WriteError(c, WrapError(CodeInvalidOutput, "call "+name, plugin.Meta().ID, err))
+			return
+		}
+	}
+	c.JSON(200, output)
+}
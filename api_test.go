@@ -0,0 +1,180 @@
+package goplugify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"testing"
+)
+
+type testContext struct {
+	context.Context
+
+	headers map[string]string
+	query   map[string]string
+	form    map[string]string
+	params  map[string]string
+	body    []byte
+
+	status int
+	resp   any
+}
+
+func newTestContext() *testContext {
+	return &testContext{
+		Context: context.Background(),
+		headers: map[string]string{},
+		query:   map[string]string{},
+		form:    map[string]string{},
+		params:  map[string]string{},
+	}
+}
+
+// newStatusTestContext returns a testContext of a server with status codes enabled,
+// see HTTPServer.SetStatusCodes.
+func newStatusTestContext() *testContext {
+	c := newTestContext()
+	c.Context = context.WithValue(c.Context, StatusCodesKey, true)
+	return c
+}
+
+func (c *testContext) GetHeader(key string) string { return c.headers[key] }
+func (c *testContext) Body() io.ReadCloser         { return io.NopCloser(bytes.NewReader(c.body)) }
+func (c *testContext) FormFile(name string) (*multipart.FileHeader, error) {
+	return nil, http.ErrMissingFile
+}
+func (c *testContext) Query(key string) string    { return c.query[key] }
+func (c *testContext) PostForm(key string) string { return c.form[key] }
+func (c *testContext) Param(key string) string    { return c.params[key] }
+
+func (c *testContext) JSON(code int, obj any) {
+	c.status = code
+	c.resp = obj
+}
+
+// decode round-trips the recorded response through JSON.
+func (c *testContext) decode(t *testing.T, v any) {
+	t.Helper()
+	data, err := json.Marshal(c.resp)
+	if err != nil {
+		t.Fatalf("marshal response: %v", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("unmarshal response %s: %v", data, err)
+	}
+}
+
+const testScript = `package main
+
+func Run(input map[string]any) (any, error) {
+	return "ran", nil
+}
+
+func Methods() map[string]func(any) any {
+	return map[string]func(any) any{
+		"echo": func(input any) any { return input },
+	}
+}
+
+func Destroy(input map[string]any) error {
+	return nil
+}
+`
+
+func putTestPlugin(t *testing.T, server *HTTPServer, id string, loader LoaderType) *testContext {
+	t.Helper()
+	c := newTestContext()
+	c.params["id"] = id
+	c.form["meta"] = `{"loader": "` + string(loader) + `"}`
+	c.body = []byte(testScript)
+	server.putPluginV2(c)
+	return c
+}
+
+func TestAPIV2Lifecycle(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+
+	c := putTestPlugin(t, server, "demo", LoaderTypeYaegiHTTP)
+	if c.status != 201 {
+		t.Fatalf("expected 201 on create, got %d: %v", c.status, c.resp)
+	}
+
+	c = putTestPlugin(t, server, "demo", LoaderTypeYaegiHTTP)
+	if c.status != 200 {
+		t.Fatalf("expected 200 on upgrade, got %d: %v", c.status, c.resp)
+	}
+
+	c = putTestPlugin(t, server, "demo", LoaderTypeNativePluginHTTP)
+	if c.status != 409 {
+		t.Fatalf("expected 409 on loader change, got %d: %v", c.status, c.resp)
+	}
+
+	c = newTestContext()
+	c.params["id"] = "demo"
+	server.runPluginV2(c)
+	if c.status != 200 || c.resp != "ran" {
+		t.Fatalf("unexpected run response %d: %v", c.status, c.resp)
+	}
+
+	c = newTestContext()
+	c.params["id"] = "demo"
+	c.params["name"] = "echo"
+	c.body = []byte(`{"a": 1}`)
+	server.callMethodV2(c)
+	var echoed map[string]float64
+	c.decode(t, &echoed)
+	if c.status != 200 || echoed["a"] != 1 {
+		t.Fatalf("unexpected method response %d: %v", c.status, c.resp)
+	}
+
+	c = newTestContext()
+	c.params["id"] = "demo"
+	server.deletePluginV2(c)
+	if c.status != 200 {
+		t.Fatalf("expected 200 on delete, got %d: %v", c.status, c.resp)
+	}
+}
+
+func TestAPIV2Errors(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+
+	tests := []struct {
+		name    string
+		handler Handler
+		setup   func(c *testContext)
+		status  int
+		code    ErrorCode
+	}{
+		{"get missing plugin", server.getPluginV2, func(c *testContext) { c.params["id"] = "nope" }, 404, "not_found"},
+		{"delete missing plugin", server.deletePluginV2, func(c *testContext) { c.params["id"] = "nope" }, 404, "not_found"},
+		{"unknown service", server.listPluginsV2, func(c *testContext) { c.query["service"] = "nope" }, 404, "not_found"},
+		{"put without meta", server.putPluginV2, func(c *testContext) { c.params["id"] = "demo" }, 400, "invalid_request"},
+		{"put with unknown loader", server.putPluginV2, func(c *testContext) {
+			c.params["id"] = "demo"
+			c.form["meta"] = `{"loader": "nope"}`
+		}, 400, "loader_not_found"},
+		{"put too large", server.putPluginV2, func(c *testContext) {
+			c.params["id"] = "demo"
+			c.headers["Content-Length"] = "1099511627776"
+		}, 413, "too_large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestContext()
+			tt.setup(c)
+			tt.handler(c)
+
+			var resp struct {
+				Error APIError `json:"error"`
+			}
+			c.decode(t, &resp)
+			if c.status != tt.status || resp.Error.Code != tt.code || resp.Error.Message == "" {
+				t.Fatalf("expected %d %s, got %d %+v", tt.status, tt.code, c.status, resp.Error)
+			}
+		})
+	}
+}
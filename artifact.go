@@ -0,0 +1,252 @@
+package goplugify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMaxNativePluginSize int64 = 256 << 20
+	DefaultMaxScriptSize       int64 = 8 << 20
+
+	// multipartOverhead is the slack allowed on top of an artifact limit for the
+	// other form fields (such as meta) and the multipart boundaries.
+	multipartOverhead int64 = 1 << 20
+)
+
+// SizeLimitedLoader is implemented by loaders that cap the size of the artifacts they accept.
+type SizeLimitedLoader interface {
+	MaxArtifactSize() int64
+}
+
+// artifactReader hashes the bytes read through it and fails with ErrArtifactTooLarge
+// as soon as more than limit bytes have been read.
+type artifactReader struct {
+	r     io.Reader
+	limit int64
+	size  int64
+	hash  hash.Hash
+}
+
+func newArtifactReader(r io.Reader, limit int64) *artifactReader {
+	return &artifactReader{
+		r:     r,
+		limit: limit,
+		hash:  sha256.New(),
+	}
+}
+
+func (a *artifactReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = bodyError(err)
+	}
+	a.size += int64(n)
+	if a.limit > 0 && a.size > a.limit {
+		return 0, ErrArtifactTooLarge
+	}
+	a.hash.Write(p[:n])
+	return n, err
+}
+
+// Sum returns the hex encoded SHA-256 of everything read so far.
+func (a *artifactReader) Sum() string {
+	return hex.EncodeToString(a.hash.Sum(nil))
+}
+
+// verifiedReader fails with ErrContentHashMismatch at the end of an artifact whose
+// SHA-256 is not the signed one, before the loader makes use of it.
+type verifiedReader struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+func newVerifiedReader(r io.ReadCloser, expected string) io.ReadCloser {
+	return &verifiedReader{ReadCloser: r, hash: sha256.New(), expected: strings.ToLower(expected)}
+}
+
+func (v *verifiedReader) Read(p []byte) (int, error) {
+	n, err := v.ReadCloser.Read(p)
+	v.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(v.hash.Sum(nil)) != v.expected {
+		return n, ErrContentHashMismatch
+	}
+	return n, err
+}
+
+// readArtifact reads the whole artifact into memory, used for scripts which are
+// evaluated from a string anyway.
+func readArtifact(r io.Reader, limit int64) ([]byte, string, error) {
+	ar := newArtifactReader(r, limit)
+	content, err := io.ReadAll(ar)
+	if err != nil {
+		return nil, "", err
+	}
+	return content, ar.Sum(), nil
+}
+
+// spoolArtifact streams the artifact into a temp file without buffering it in memory.
+// The caller is responsible for removing the returned file.
+func spoolArtifact(r io.Reader, limit int64, pattern string) (string, string, error) {
+	tmpfile, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", "", err
+	}
+	defer tmpfile.Close()
+
+	ar := newArtifactReader(r, limit)
+	if _, err := io.Copy(tmpfile, ar); err != nil {
+		os.Remove(tmpfile.Name())
+		return "", "", err
+	}
+	return tmpfile.Name(), ar.Sum(), nil
+}
+
+func nativePluginTempPattern() string {
+	return fmt.Sprintf("plugin_%d_*.so", time.Now().UnixNano())
+}
+
+// HttpBodyLimitContext is implemented by contexts that can cap the bytes read from
+// the request body, so that an upload without Content-Length, such as a chunked one,
+// is rejected once it exceeds the limit rather than spooled whole.
+type HttpBodyLimitContext interface {
+	LimitBody(limit int64)
+}
+
+// checkContentLength rejects a request whose declared length already exceeds limit,
+// before any of its body is read, and caps the body of the others.
+func checkContentLength(c HttpContext, limit int64) error {
+	if limit <= 0 {
+		return nil
+	}
+	if strings.Contains(c.GetHeader("Content-Type"), "multipart/form-data") {
+		limit += multipartOverhead
+	}
+	length, err := strconv.ParseInt(c.GetHeader("Content-Length"), 10, 64)
+	if err == nil && length > limit {
+		return fmt.Errorf("%w: %d bytes exceeds %d", ErrArtifactTooLarge, length, limit)
+	}
+	switch bc := c.(type) {
+	case HttpBodyLimitContext:
+		bc.LimitBody(limit)
+	case HttpRequestContext:
+		if req := bc.Request(); req != nil && req.PostForm == nil && req.MultipartForm == nil {
+			req.Body = http.MaxBytesReader(nil, req.Body, limit)
+		}
+	}
+	return nil
+}
+
+// bodyError maps the error of a request body read past its limit to
+// ErrArtifactTooLarge.
+func bodyError(err error) error {
+	var maxBytes *http.MaxBytesError
+	if errors.As(err, &maxBytes) {
+		return fmt.Errorf("%w: body exceeds %d bytes", ErrArtifactTooLarge, maxBytes.Limit)
+	}
+	return err
+}
+
+// formValue returns the form field key of c, failing when the form cannot be parsed.
+func formValue(c HttpContext, key string) (string, error) {
+	value := c.PostForm(key)
+	if fc, ok := c.(interface{ formError() error }); ok && value == "" && fc.formError() != nil {
+		return "", fc.formError()
+	}
+	return value, nil
+}
+
+// openPluginContent returns the uploaded artifact, either the "file" form field of a
+// multipart request or the raw request body. It is checked against the content hash
+// signed for the request, see ContentHashOf.
+func openPluginContent(c HttpContext, limit int64) (io.ReadCloser, error) {
+	content, err := openUpload(c, limit)
+	if err != nil {
+		return nil, err
+	}
+	if expected := ContentHashOf(c); expected != "" {
+		return newVerifiedReader(content, expected), nil
+	}
+	return content, nil
+}
+
+// checkSignedField compares sum, the hex SHA-256 of a form field of an upload, with
+// the hash signed for it under key. The fields of an upload whose artifact hash is
+// signed must be signed too, or they could be swapped.
+func checkSignedField(c HttpContext, key, field, sum string) error {
+	expected := signedHash(c, key)
+	if expected == "" {
+		if ContentHashOf(c) != "" {
+			return NewCodeError(CodeUnauthorized, field+" hash is not signed")
+		}
+		return nil
+	}
+	if !strings.EqualFold(expected, sum) {
+		return fmt.Errorf("%w: %s", ErrContentHashMismatch, field)
+	}
+	return nil
+}
+
+// withVerifiedHash records on plugin the content hash its artifact was checked
+// against by openPluginContent.
+func withVerifiedHash(plugin IPlugin, c HttpContext) IPlugin {
+	if hash := ContentHashOf(c); hash != "" {
+		if p, ok := plugin.(interface{ setVerifiedHash(string) }); ok {
+			p.setVerifiedHash(strings.ToLower(hash))
+		}
+	}
+	return plugin
+}
+
+func openUpload(c HttpContext, limit int64) (io.ReadCloser, error) {
+	if err := checkContentLength(c, limit); err != nil {
+		return nil, err
+	}
+
+	ct := c.GetHeader("Content-Type")
+	if !strings.Contains(ct, "multipart/form-data") {
+		return c.Body(), nil
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return nil, fmt.Errorf("file error: %w raw ct: %s", err, ct)
+	}
+	if limit > 0 && file.Size > limit {
+		return nil, fmt.Errorf("%w: %d bytes exceeds %d", ErrArtifactTooLarge, file.Size, limit)
+	}
+	return file.Open()
+}
+
+// openFile opens a file:// or http(s):// artifact location for streaming.
+func openFile(url string, limit int64) (io.ReadCloser, error) {
+	if strings.HasPrefix(url, "file://") {
+		filePath := strings.TrimPrefix(url, "file://")
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if limit > 0 && info.Size() > limit {
+			return nil, fmt.Errorf("%w: %d bytes exceeds %d", ErrArtifactTooLarge, info.Size(), limit)
+		}
+		return os.Open(filePath)
+	}
+	return httpGet(url, limit)
+}
+
+func maxSizeOr(size, def int64) int64 {
+	if size > 0 {
+		return size
+	}
+	return def
+}
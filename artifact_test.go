@@ -0,0 +1,228 @@
+package goplugify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadArtifact(t *testing.T) {
+	content := "package main\n\nfunc Run(input map[string]any) (any, error) { return nil, nil }\n"
+	sum := sha256.Sum256([]byte(content))
+
+	data, hash, err := readArtifact(strings.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(data) != content {
+		t.Errorf("content mismatch: %q", data)
+	}
+	if hash != hex.EncodeToString(sum[:]) {
+		t.Errorf("hash mismatch: %s", hash)
+	}
+
+	_, _, err = readArtifact(strings.NewReader(content), int64(len(content)-1))
+	if !errors.Is(err, ErrArtifactTooLarge) {
+		t.Fatalf("expected ErrArtifactTooLarge, got %v", err)
+	}
+}
+
+func TestSpoolArtifact(t *testing.T) {
+	content := strings.Repeat("x", 100000)
+	sum := sha256.Sum256([]byte(content))
+
+	path, hash, err := spoolArtifact(strings.NewReader(content), 0, "artifact_test_*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Remove(path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read spooled file: %v", err)
+	}
+	if string(data) != content {
+		t.Errorf("spooled content mismatch, got %d bytes", len(data))
+	}
+	if hash != hex.EncodeToString(sum[:]) {
+		t.Errorf("hash mismatch: %s", hash)
+	}
+
+	_, _, err = spoolArtifact(strings.NewReader(content), 1024, "artifact_test_*")
+	if !errors.Is(err, ErrArtifactTooLarge) {
+		t.Fatalf("expected ErrArtifactTooLarge, got %v", err)
+	}
+}
+
+// signedUpload is a multipart upload with the hashes signed for it, empty hashes
+// are not sent.
+type signedUpload struct {
+	fields, files               map[string]string
+	content, meta, assetsHashed string
+}
+
+func TestSignedContentHash(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	server.SetStatusCodes(true)
+	mux := NewServeMuxRouter(nil)
+	server.RegisterRoutes(WithAuthHttpRouter(mux, NewHMACAuth("app", "secret")), "/api")
+
+	hashOf := func(data string) string {
+		sum := sha256.Sum256([]byte(data))
+		return hex.EncodeToString(sum[:])
+	}
+	send := func(path string, upload signedUpload) (int, string) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for name, value := range upload.fields {
+			mw.WriteField(name, value)
+		}
+		for name, content := range upload.files {
+			fw, _ := mw.CreateFormFile(name, name+".go")
+			fw.Write([]byte(content))
+		}
+		mw.Close()
+		req := httptest.NewRequest("POST", path, &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		if upload.meta != "" {
+			req.Header.Set("X-Go-Plugify-Meta-Hash", upload.meta)
+		}
+		if upload.assetsHashed != "" {
+			req.Header.Set("X-Go-Plugify-Assets-Hash", upload.assetsHashed)
+		}
+		SignRequest(req, SignVersion2, "app", "secret", upload.content)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+	meta := `{"id": "demo", "loader": "yaegi_http"}`
+	load := func(script string) signedUpload {
+		return signedUpload{
+			fields:  map[string]string{"meta": meta},
+			files:   map[string]string{"file": script},
+			content: hashOf(testScript),
+			meta:    hashOf(meta),
+		}
+	}
+	manager := server.Registry().managers["default"]
+
+	unsigned := load(testScript)
+	unsigned.content = ""
+	if status, body := send("/api/plugin/load", unsigned); status != 401 || !strings.Contains(body, "missing content hash") {
+		t.Errorf("expected an unsigned artifact to be rejected, got %d %s", status, body)
+	}
+	swapped := strings.Replace(testScript, "package main", "package main\n\n// swapped", 1)
+	if status, body := send("/api/plugin/load", load(swapped)); status != 401 || !strings.Contains(body, "signed content hash") {
+		t.Errorf("expected a swapped artifact to be rejected, got %d %s", status, body)
+	}
+	unsignedMeta := load(testScript)
+	unsignedMeta.meta = ""
+	if status, body := send("/api/plugin/load", unsignedMeta); status != 401 || !strings.Contains(body, "meta hash is not signed") {
+		t.Errorf("expected an unsigned meta to be rejected, got %d %s", status, body)
+	}
+	swappedMeta := load(testScript)
+	swappedMeta.fields = map[string]string{"meta": `{"id": "other", "loader": "yaegi_http"}`}
+	if status, body := send("/api/plugin/load", swappedMeta); status != 401 || !strings.Contains(body, "meta") {
+		t.Errorf("expected a swapped meta to be rejected, got %d %s", status, body)
+	}
+	withAssets := load(testScript)
+	withAssets.files["assets"] = "not signed"
+	if status, body := send("/api/plugin/load", withAssets); status != 401 || !strings.Contains(body, "assets hash is not signed") {
+		t.Errorf("expected unsigned assets to be rejected, got %d %s", status, body)
+	}
+	withAssets.assetsHashed = hashOf("other assets")
+	if status, body := send("/api/plugin/load", withAssets); status != 401 || !strings.Contains(body, "assets") {
+		t.Errorf("expected swapped assets to be rejected, got %d %s", status, body)
+	}
+	if _, err := manager.GetPlugin("demo"); err == nil {
+		t.Fatal("expected the tampered uploads not to be loaded")
+	}
+
+	signed := load(testScript)
+	signed.content = strings.ToUpper(signed.content)
+	if status, body := send("/api/plugin/load", signed); status != 200 {
+		t.Fatalf("expected the signed artifact to load, got %d %s", status, body)
+	}
+	plugin, _ := manager.GetPlugin("demo")
+	if stats := StatsOf(plugin); stats.VerifiedHash != hashOf(testScript) || stats.ContentHash != stats.VerifiedHash {
+		t.Errorf("expected the verified hash on the plugin, got %+v", stats)
+	}
+
+	changes := func(hash string) string {
+		return `[{"action": "load", "meta": {"id": "other", "loader": "yaegi_http"}, "file": "f", "content_hash": "` + hash + `"}]`
+	}
+	batch := func(changes, signedHash string) signedUpload {
+		return signedUpload{
+			fields:  map[string]string{"changes": changes},
+			files:   map[string]string{"f": testScript},
+			content: signedHash,
+		}
+	}
+	if status, body := send("/api/plugin/batch", batch(changes(hashOf(testScript)), hashOf("tampered"))); status != 401 {
+		t.Errorf("expected a batch with swapped changes to be rejected, got %d %s", status, body)
+	}
+	if status, body := send("/api/plugin/batch", batch(changes(hashOf(swapped)), hashOf(changes(hashOf(swapped))))); status != 401 {
+		t.Errorf("expected a batch with a swapped artifact to be rejected, got %d %s", status, body)
+	}
+	if status, body := send("/api/plugin/batch", batch(changes(""), hashOf(changes("")))); status != 400 {
+		t.Errorf("expected a signed batch without artifact hashes to be rejected, got %d %s", status, body)
+	}
+	if status, body := send("/api/plugin/batch", batch(changes(hashOf(testScript)), hashOf(changes(hashOf(testScript))))); status != 200 {
+		t.Errorf("expected the signed batch to load, got %d %s", status, body)
+	}
+}
+
+// valuelessRouter hides the optional interfaces of the contexts of ServeMuxRouter,
+// HttpValueContext among them.
+type valuelessRouter struct {
+	*ServeMuxRouter
+}
+
+func (r valuelessRouter) Add(method, path string, handler Handler) {
+	r.ServeMuxRouter.Add(method, path, func(c HttpContext) {
+		handler(struct{ HttpContext }{c})
+	})
+}
+
+func TestSignedContentHashWithoutValues(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	mux := valuelessRouter{NewServeMuxRouter(nil)}
+	server.RegisterRoutes(WithAuthHttpRouter(mux, NewHMACAuth("app", "secret")), "/api")
+
+	meta := `{"id": "demo", "loader": "yaegi_http"}`
+	send := func(script, contentHash string) (int, string) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("meta", meta)
+		fw, _ := mw.CreateFormFile("file", "plugin.go")
+		fw.Write([]byte(script))
+		mw.Close()
+		req := httptest.NewRequest("POST", "/api/plugin/load", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		sum := sha256.Sum256([]byte(meta))
+		req.Header.Set("X-Go-Plugify-Meta-Hash", hex.EncodeToString(sum[:]))
+		SignRequest(req, SignVersion1, "app", "secret", contentHash)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+	sum := sha256.Sum256([]byte(testScript))
+	hash := hex.EncodeToString(sum[:])
+
+	if status, body := send(testScript, ""); !strings.Contains(body, "missing content hash") {
+		t.Errorf("expected an unsigned artifact to be rejected, got %d %s", status, body)
+	}
+	swapped := strings.Replace(testScript, "package main", "package main\n\n// swapped", 1)
+	if status, body := send(swapped, hash); !strings.Contains(body, "signed content hash") {
+		t.Errorf("expected a swapped artifact to be rejected, got %d %s", status, body)
+	}
+	if status, body := send(testScript, hash); status != 200 {
+		t.Errorf("expected the signed artifact to load, got %d %s", status, body)
+	}
+}
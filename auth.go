@@ -1,24 +1,74 @@
 package goplugify
 
 import (
+	"context"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type AuthHttpRouter struct {
-	router HttpRouter
-	auth   Authenticator
+	router      HttpRouter
+	auth        Authenticator
+	authorizer  Authorizer
+	errorWriter ErrorWriter
 }
 
 func (a *AuthHttpRouter) Add(method, path string, handler Handler) {
-	a.router.Add(method, path, WithAuthMiddleware(handler, a.auth))
+	a.router.Add(method, path, withAuthMiddleware(handler, a.auth, a.errorWriter))
+}
+
+// addRoute adds a management route, checking its permissions once authenticated.
+func (a *AuthHttpRouter) addRoute(route Route) {
+	if route.ContentHash && route.Secured {
+		route.handler = requireContentHash(route.handler, a.errorWriter)
+	}
+	handler := route.handler
+	if a.authorizer != nil && len(route.Permissions) > 0 {
+		handler = withAuthorization(route, a.authorizer, a.errorWriter)
+	}
+	a.Add(route.Method, route.Path, handler)
+}
+
+// WithErrorWriter returns a router sharing the authenticator whose authentication
+// failures are written by w.
+func (a *AuthHttpRouter) WithErrorWriter(w ErrorWriter) HttpRouter {
+	return &AuthHttpRouter{
+		router:      a.router,
+		auth:        a.auth,
+		authorizer:  a.authorizer,
+		errorWriter: w,
+	}
+}
+
+// isHMACRouter reports whether the routes added to router require HMAC signatures.
+func isHMACRouter(router HttpRouter) bool {
+	ar, ok := router.(*AuthHttpRouter)
+	if !ok {
+		return false
+	}
+	_, ok = ar.auth.(*HMACAuth)
+	return ok
+}
+
+// ErrorWriter writes an error response, such as ErrorRet or WriteError.
+type ErrorWriter func(c HttpContext, err error)
+
+// ErrorWriterRouter is implemented by routers that answer some requests themselves,
+// so that route sets with their own error format can keep it consistent.
+type ErrorWriterRouter interface {
+	HttpRouter
+	WithErrorWriter(w ErrorWriter) HttpRouter
 }
 
 func WithAuthHttpRouter(router HttpRouter, auth Authenticator) HttpRouter {
@@ -28,14 +78,46 @@ func WithAuthHttpRouter(router HttpRouter, auth Authenticator) HttpRouter {
 	}
 }
 
+// WithAuthorizerHttpRouter is WithAuthHttpRouter that also checks the permissions of
+// the management routes with authorizer.
+func WithAuthorizerHttpRouter(router HttpRouter, auth Authenticator, authorizer Authorizer) HttpRouter {
+	return &AuthHttpRouter{
+		router:     router,
+		auth:       auth,
+		authorizer: authorizer,
+	}
+}
+
 type Authenticator interface {
 	Auth(c HttpContext) error
 }
 
 func WithAuthMiddleware(handler Handler, auth Authenticator) Handler {
+	return withAuthMiddleware(handler, auth, ErrorRet)
+}
+
+func withAuthMiddleware(handler Handler, auth Authenticator, errorWriter ErrorWriter) Handler {
+	if errorWriter == nil {
+		errorWriter = ErrorRet
+	}
 	return func(c HttpContext) {
 		if err := auth.Auth(c); err != nil {
-			ErrorRet(c, fmt.Errorf("authentication failed: %v", err))
+			errorWriter(c, fmt.Errorf("%w: %v", ErrUnauthorized, err))
+			return
+		}
+		handler(c)
+	}
+}
+
+// requireContentHash rejects the uploads whose content hash was not signed, the
+// artifact could be swapped otherwise.
+func requireContentHash(handler Handler, errorWriter ErrorWriter) Handler {
+	if errorWriter == nil {
+		errorWriter = ErrorRet
+	}
+	return func(c HttpContext) {
+		if ContentHashOf(c) == "" {
+			errorWriter(c, fmt.Errorf("%w: missing content hash", ErrUnauthorized))
 			return
 		}
 		handler(c)
@@ -48,9 +130,26 @@ func (a NoAuth) Auth(c HttpContext) error {
 	return nil
 }
 
+// DefaultMaxClockSkew is how far the timestamp of a request may be from the server
+// clock, in the past or in the future.
+var DefaultMaxClockSkew = 5 * time.Minute
+
 type HMACAuth struct {
 	AppID     string
 	AppSecret string
+	// Credentials authenticates several apps, each with its own secrets. AppID and
+	// AppSecret are ignored when it is set.
+	Credentials CredentialProvider
+	// MaxSkew is DefaultMaxClockSkew when zero.
+	MaxSkew time.Duration
+	// MinSignVersion rejects the signatures of older versions, such as SignVersion1
+	// which does not cover the route.
+	MinSignVersion int
+	// Nonces rejects replayed requests, a MemoryNonceStore of DefaultNonceCapacity
+	// when nil. Nodes behind a load balancer share a SharedNonceStore.
+	Nonces NonceStore
+
+	defaultNonces sync.Once
 }
 
 func NewHMACAuth(appID, appSecret string) *HMACAuth {
@@ -60,26 +159,136 @@ func NewHMACAuth(appID, appSecret string) *HMACAuth {
 	}
 }
 
+// NewCredentialsHMACAuth authenticates the apps known to credentials.
+func NewCredentialsHMACAuth(credentials CredentialProvider) *HMACAuth {
+	return &HMACAuth{Credentials: credentials}
+}
+
 func (a *HMACAuth) Auth(c HttpContext) error {
 	signature := c.GetHeader("X-Go-Plugify-Signature")
 	if signature == "" {
 		return errors.New("missing signature header")
 	}
 
-	params := GetHMACAuthSignParamsFromContext(c, a.AppSecret)
-	if params.AppID != a.AppID {
-		return errors.New("invalid appid")
+	params := GetHMACAuthSignParamsFromContext(c, "")
+	secrets, err := a.secrets(c, params.AppID)
+	if err != nil {
+		return err
+	}
+	if params.Nonce == "" {
+		return errors.New("missing nonce")
+	}
+	if params.Version < SignVersion1 || params.Version > SignVersion2 {
+		return errors.New("unsupported signature version")
+	}
+	if params.Version < a.MinSignVersion {
+		return fmt.Errorf("signature version %d is required", a.MinSignVersion)
+	}
+	if params.Version >= SignVersion2 {
+		if _, _, _, ok := requestLine(c); !ok {
+			return errors.New("the http router does not expose the request line a version 2 signature covers")
+		}
+		// Parameters dropped by the parser would not be covered by the signature.
+		if _, err := url.ParseQuery(params.Query); err != nil {
+			return fmt.Errorf("invalid query: %v", err)
+		}
+	}
+
+	skew := a.MaxSkew
+	if skew <= 0 {
+		skew = DefaultMaxClockSkew
+	}
+	// While a secret is rotated the clients may sign with either of them.
+	for _, secret := range secrets {
+		params.AppSecret = secret
+		if err = params.verifySignature(signature, skew); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Only signed nonces are remembered, others could fill the store.
+	a.defaultNonces.Do(func() {
+		if a.Nonces == nil {
+			a.Nonces = NewMemoryNonceStore(DefaultNonceCapacity)
+		}
+	})
+	ts, _ := strconv.ParseInt(params.Timestamp, 10, 64)
+	fresh, err := a.Nonces.Remember(c, params.AppID+":"+params.Nonce, time.Unix(ts, 0).Add(skew))
+	if err != nil {
+		return fmt.Errorf("nonce store: %v", err)
+	}
+	if !fresh {
+		return errors.New("nonce already used")
 	}
+	if vc, ok := c.(HttpValueContext); ok {
+		vc.Set(AppIDKey, params.AppID)
+		for key, hash := range map[string]string{
+			ContentHashKey: params.ContentHash,
+			MetaHashKey:    params.MetaHash,
+			AssetsHashKey:  params.AssetsHash,
+		} {
+			if hash != "" {
+				vc.Set(key, hash)
+			}
+		}
+	}
+	return nil
+}
 
-	return params.VerifySignature(signature)
+// secrets returns the secrets appID may sign its requests with.
+func (a *HMACAuth) secrets(ctx context.Context, appID string) ([]string, error) {
+	if a.Credentials == nil {
+		if appID != a.AppID {
+			return nil, errors.New("invalid appid")
+		}
+		return []string{a.AppSecret}, nil
+	}
+	credential, err := a.Credentials.Credential(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("credentials: %v", err)
+	}
+	if credential == nil {
+		return nil, errors.New("invalid appid")
+	}
+	if credential.Disabled {
+		return nil, errors.New("app disabled")
+	}
+	secrets := credential.activeSecrets(time.Now())
+	if len(secrets) == 0 {
+		return nil, errors.New("no active secret")
+	}
+	return secrets, nil
 }
 
+// Signature versions, sent in the X-Go-Plugify-Sign-Version header. Version 1, the
+// default, signs the credentials and the content hash only. Version 2 also signs
+// the method, the path and the query of the request, so that a signature cannot be
+// reused on another route.
+const (
+	SignVersion1 = 1
+	SignVersion2 = 2
+)
+
 type HMACAuthSignParams struct {
 	AppID       string
 	AppSecret   string
 	Timestamp   string
 	Nonce       string
 	ContentHash string
+	// MetaHash and AssetsHash are the hex SHA-256 of the meta and assets form
+	// fields of an upload, signed along with the artifact.
+	MetaHash   string
+	AssetsHash string
+
+	// Version is SignVersion1 when zero. Method, Path and Query, the raw query
+	// string, are signed from SignVersion2 on.
+	Version int
+	Method  string
+	Path    string
+	Query   string
 }
 
 func GetHMACAuthSignParamsFromContext(c HttpContext, appSecret string) HMACAuthSignParams {
@@ -88,13 +297,79 @@ func GetHMACAuthSignParamsFromContext(c HttpContext, appSecret string) HMACAuthS
 	nonce := c.GetHeader("X-Go-Plugify-Nonce")
 	ContentHash := c.GetHeader("X-Go-Plugify-Content-Hash")
 
-	return HMACAuthSignParams{
+	params := HMACAuthSignParams{
 		AppID:       appid,
 		AppSecret:   appSecret,
 		Timestamp:   timestamp,
 		Nonce:       nonce,
 		ContentHash: ContentHash,
+		MetaHash:    c.GetHeader("X-Go-Plugify-Meta-Hash"),
+		AssetsHash:  c.GetHeader("X-Go-Plugify-Assets-Hash"),
+		Version:     SignVersion1,
+	}
+	if version := c.GetHeader("X-Go-Plugify-Sign-Version"); version != "" {
+		// An unknown version is kept as -1 and rejected by HMACAuth.
+		params.Version = -1
+		if v, err := strconv.Atoi(version); err == nil && v >= SignVersion1 {
+			params.Version = v
+		}
+	}
+	if params.Version >= SignVersion2 {
+		params.Method, params.Path, params.Query, _ = requestLine(c)
 	}
+	return params
+}
+
+// HttpURLContext is implemented by contexts that expose the request line, which
+// signatures of SignVersion2 cover.
+type HttpURLContext interface {
+	Method() string
+	Path() string
+	RawQuery() string
+}
+
+// requestLine returns the method, path and raw query of the request of c.
+func requestLine(c HttpContext) (method, path, query string, ok bool) {
+	if uc, ok := c.(HttpURLContext); ok {
+		return uc.Method(), uc.Path(), uc.RawQuery(), true
+	}
+	if rc, ok := c.(HttpRequestContext); ok && rc.Request() != nil {
+		req := rc.Request()
+		return req.Method, req.URL.Path, req.URL.RawQuery, true
+	}
+	return "", "", "", false
+}
+
+// SignRequest sets on req the headers HMACAuth authenticates, with a new nonce.
+// contentHash is the hex SHA-256 of the uploaded artifact, empty for other requests.
+// The X-Go-Plugify-Meta-Hash and X-Go-Plugify-Assets-Hash headers of an upload are
+// set beforehand and signed as well.
+func SignRequest(req *http.Request, version int, appID, appSecret, contentHash string) {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	params := HMACAuthSignParams{
+		AppID:       appID,
+		AppSecret:   appSecret,
+		Timestamp:   strconv.FormatInt(time.Now().Unix(), 10),
+		Nonce:       hex.EncodeToString(nonce),
+		ContentHash: contentHash,
+		MetaHash:    req.Header.Get("X-Go-Plugify-Meta-Hash"),
+		AssetsHash:  req.Header.Get("X-Go-Plugify-Assets-Hash"),
+		Version:     version,
+		Method:      req.Method,
+		Path:        req.URL.Path,
+		Query:       req.URL.RawQuery,
+	}
+	req.Header.Set("X-Go-Plugify-Appid", params.AppID)
+	req.Header.Set("X-Go-Plugify-Timestamp", params.Timestamp)
+	req.Header.Set("X-Go-Plugify-Nonce", params.Nonce)
+	if contentHash != "" {
+		req.Header.Set("X-Go-Plugify-Content-Hash", contentHash)
+	}
+	if version >= SignVersion2 {
+		req.Header.Set("X-Go-Plugify-Sign-Version", strconv.Itoa(version))
+	}
+	req.Header.Set("X-Go-Plugify-Signature", params.GenerateSignature())
 }
 
 func (params *HMACAuthSignParams) GenerateSignature() string {
@@ -104,14 +379,24 @@ func (params *HMACAuthSignParams) GenerateSignature() string {
 	return hex.EncodeToString(mac.Sum(nil))
 }
 
+// VerifySignature checks the signature and that the timestamp is within
+// DefaultMaxClockSkew of the server clock. It does not detect replays, HMACAuth does.
 func (params *HMACAuthSignParams) VerifySignature(providedSign string) error {
+	return params.verifySignature(providedSign, DefaultMaxClockSkew)
+}
+
+func (params *HMACAuthSignParams) verifySignature(providedSign string, skew time.Duration) error {
 	ts, err := strconv.ParseInt(params.Timestamp, 10, 64)
 	if err != nil {
 		return errors.New("invalid timestamp")
 	}
-	if time.Since(time.Unix(ts, 0)) > 5*time.Minute {
+	offset := time.Since(time.Unix(ts, 0))
+	if offset > skew {
 		return errors.New("timestamp expired")
 	}
+	if offset < -skew {
+		return errors.New("timestamp is in the future")
+	}
 
 	expected := params.GenerateSignature()
 	if !hmac.Equal([]byte(expected), []byte(providedSign)) {
@@ -122,6 +407,27 @@ func (params *HMACAuthSignParams) VerifySignature(providedSign string) error {
 }
 
 func (params *HMACAuthSignParams) buildCanonicalString() string {
+	if params.Version < SignVersion2 {
+		return params.buildCredentialsString()
+	}
+	// The path and the query are escaped, no line of the string has a line break.
+	return strings.Join([]string{
+		strconv.Itoa(params.Version),
+		strings.ToUpper(params.Method),
+		(&url.URL{Path: params.Path}).EscapedPath(),
+		canonicalQuery(params.Query),
+		params.buildCredentialsString(),
+	}, "\n")
+}
+
+// canonicalQuery sorts the parameters of a raw query string by key, keeping the
+// order of the values of a key. HMACAuth rejects the queries that fail to parse.
+func canonicalQuery(raw string) string {
+	values, _ := url.ParseQuery(raw)
+	return values.Encode()
+}
+
+func (params *HMACAuthSignParams) buildCredentialsString() string {
 	kv := map[string]string{
 		"appid":     params.AppID,
 		"timestamp": params.Timestamp,
@@ -131,6 +437,12 @@ func (params *HMACAuthSignParams) buildCanonicalString() string {
 	if params.ContentHash != "" {
 		kv["content_hash"] = params.ContentHash
 	}
+	if params.MetaHash != "" {
+		kv["meta_hash"] = params.MetaHash
+	}
+	if params.AssetsHash != "" {
+		kv["assets_hash"] = params.AssetsHash
+	}
 
 	keys := make([]string, 0, len(kv))
 	for k := range kv {
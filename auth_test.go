@@ -0,0 +1,192 @@
+package goplugify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func signedTestContext(appID, secret, nonce string, at time.Time) *testContext {
+	params := HMACAuthSignParams{
+		AppID:     appID,
+		AppSecret: secret,
+		Timestamp: strconv.FormatInt(at.Unix(), 10),
+		Nonce:     nonce,
+	}
+	c := newTestContext()
+	c.headers["X-Go-Plugify-Appid"] = appID
+	c.headers["X-Go-Plugify-Timestamp"] = params.Timestamp
+	c.headers["X-Go-Plugify-Nonce"] = nonce
+	c.headers["X-Go-Plugify-Signature"] = params.GenerateSignature()
+	return c
+}
+
+func TestHMACAuthReplayAndSkew(t *testing.T) {
+	auth := NewHMACAuth("app", "secret")
+	now := time.Now()
+
+	if err := auth.Auth(signedTestContext("app", "secret", "n1", now)); err != nil {
+		t.Fatalf("expected a signed request to pass: %v", err)
+	}
+	if err := auth.Auth(signedTestContext("app", "secret", "n1", now)); err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Errorf("expected a replay to be rejected, got %v", err)
+	}
+	if err := auth.Auth(signedTestContext("app", "wrong", "n2", now)); err == nil {
+		t.Error("expected a bad signature to be rejected")
+	}
+	// The failed attempt must not burn the nonce.
+	if err := auth.Auth(signedTestContext("app", "secret", "n2", now)); err != nil {
+		t.Errorf("expected an unused nonce to pass: %v", err)
+	}
+	if err := auth.Auth(signedTestContext("app", "secret", "", now)); err == nil {
+		t.Error("expected a missing nonce to be rejected")
+	}
+	if err := auth.Auth(signedTestContext("app", "secret", "n3", now.Add(10*time.Minute))); err == nil || !strings.Contains(err.Error(), "future") {
+		t.Errorf("expected a future timestamp to be rejected, got %v", err)
+	}
+	if err := auth.Auth(signedTestContext("app", "secret", "n4", now.Add(-10*time.Minute))); err == nil {
+		t.Error("expected an old timestamp to be rejected")
+	}
+
+	auth.MaxSkew = 30 * time.Second
+	if err := auth.Auth(signedTestContext("app", "secret", "n5", now.Add(time.Minute))); err == nil {
+		t.Error("expected the skew window to be configurable")
+	}
+	if err := auth.Auth(signedTestContext("app", "secret", "n6", now.Add(20*time.Second))); err != nil {
+		t.Errorf("expected a timestamp within the skew to pass: %v", err)
+	}
+}
+
+func TestMemoryNonceStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryNonceStore(2)
+	expiry := time.Now().Add(time.Minute)
+	for _, nonce := range []string{"a", "b"} {
+		if ok, _ := store.Remember(ctx, nonce, expiry); !ok {
+			t.Fatalf("expected %s to be fresh", nonce)
+		}
+	}
+	if ok, _ := store.Remember(ctx, "a", expiry); ok {
+		t.Error("expected a to be remembered")
+	}
+	store.Remember(ctx, "c", expiry)
+	if ok, _ := store.Remember(ctx, "a", expiry); !ok {
+		t.Error("expected the oldest nonce to be evicted once full")
+	}
+
+	store = NewMemoryNonceStore(10)
+	store.Remember(ctx, "old", time.Now().Add(-time.Second))
+	if ok, _ := store.Remember(ctx, "old", expiry); !ok {
+		t.Error("expected an expired nonce to be accepted again")
+	}
+}
+
+type testSetNXStore struct {
+	keys map[string]time.Time
+	lock sync.Mutex
+}
+
+func (s *testSetNXStore) SetNX(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if expiry, ok := s.keys[key]; ok && time.Now().Before(expiry) {
+		return false, nil
+	}
+	s.keys[key] = time.Now().Add(ttl)
+	return true, nil
+}
+
+func TestSharedNonceStore(t *testing.T) {
+	shared := &testSetNXStore{keys: map[string]time.Time{}}
+	first, second := NewHMACAuth("app", "secret"), NewHMACAuth("app", "secret")
+	first.Nonces = NewSharedNonceStore(shared, "plugify:nonce:")
+	second.Nonces = first.Nonces
+
+	if err := first.Auth(signedTestContext("app", "secret", "n1", time.Now())); err != nil {
+		t.Fatalf("expected the first node to accept the request: %v", err)
+	}
+	if err := second.Auth(signedTestContext("app", "secret", "n1", time.Now())); err == nil {
+		t.Error("expected the replay on another node to be rejected")
+	}
+	if _, ok := shared.keys["plugify:nonce:app:n1"]; !ok {
+		t.Errorf("expected the prefixed nonce in the shared store, got %v", shared.keys)
+	}
+}
+
+func TestHMACAuthSignVersion2(t *testing.T) {
+	auth := NewHMACAuth("app", "secret")
+	mux := NewServeMuxRouter(nil)
+	router := WithAuthHttpRouter(mux, auth).(*AuthHttpRouter).WithErrorWriter(StatusErrorRet)
+	for _, route := range []string{"GET /api/plugin/list", "POST /api/plugin/unload"} {
+		method, path, _ := strings.Cut(route, " ")
+		router.Add(method, path, func(c HttpContext) { c.JSON(200, map[string]any{}) })
+	}
+	send := func(req *http.Request) int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	signed := func(method, target string) *http.Request {
+		req := httptest.NewRequest(method, target, nil)
+		SignRequest(req, SignVersion2, "app", "secret", "")
+		return req
+	}
+
+	if status := send(signed("GET", "/api/plugin/list?b=2&a=1")); status != 200 {
+		t.Fatalf("expected a v2 signature to pass, got %d", status)
+	}
+
+	listing := signed("GET", "/api/plugin/list")
+	unload := httptest.NewRequest("POST", "/api/plugin/unload?plugin_id=demo", nil)
+	unload.Header = listing.Header
+	if status := send(unload); status != 401 {
+		t.Errorf("expected the signature of another route to be rejected, got %d", status)
+	}
+
+	tampered := signed("POST", "/api/plugin/unload?plugin_id=a")
+	tampered.URL.RawQuery = "plugin_id=b"
+	if status := send(tampered); status != 401 {
+		t.Errorf("expected a changed query to be rejected, got %d", status)
+	}
+
+	reordered := signed("POST", "/api/plugin/unload?plugin_id=a&service=default")
+	reordered.URL.RawQuery = "service=default&plugin_id=a"
+	if status := send(reordered); status != 200 {
+		t.Errorf("expected the query order not to matter, got %d", status)
+	}
+
+	// "plugin_id=b;x" is dropped by the query parser, it could be changed freely.
+	unparsed := signed("POST", "/api/plugin/unload?plugin_id=a&plugin_id=b;x")
+	if status := send(unparsed); status != 401 {
+		t.Errorf("expected a query that fails to parse to be rejected, got %d", status)
+	}
+
+	legacy := httptest.NewRequest("GET", "/api/plugin/list", nil)
+	SignRequest(legacy, SignVersion1, "app", "secret", "")
+	if status := send(legacy); status != 200 {
+		t.Errorf("expected v1 signatures to pass by default, got %d", status)
+	}
+	auth.MinSignVersion = SignVersion2
+	legacy = httptest.NewRequest("GET", "/api/plugin/list", nil)
+	SignRequest(legacy, SignVersion1, "app", "secret", "")
+	if status := send(legacy); status != 401 {
+		t.Errorf("expected v1 signatures to be rejected once v2 is required, got %d", status)
+	}
+
+	unknown := signed("GET", "/api/plugin/list")
+	unknown.Header.Set("X-Go-Plugify-Sign-Version", "3")
+	if status := send(unknown); status != 401 {
+		t.Errorf("expected an unknown version to be rejected, got %d", status)
+	}
+
+	c := signedTestContext("app", "secret", "n1", time.Now())
+	c.headers["X-Go-Plugify-Sign-Version"] = "2"
+	if err := auth.Auth(c); err == nil || !strings.Contains(err.Error(), "request line") {
+		t.Errorf("expected v2 to need the request line, got %v", err)
+	}
+}
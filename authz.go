@@ -0,0 +1,133 @@
+package goplugify
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Permission is an action on the management API an identity can be granted.
+type Permission string
+
+const (
+	PermList   Permission = "list"
+	PermRun    Permission = "run"
+	PermLoad   Permission = "load"
+	PermUnload Permission = "unload"
+	// PermComponents covers the components exposed to plugins.
+	PermComponents Permission = "components"
+	// PermAll grants every permission.
+	PermAll Permission = "*"
+)
+
+// Access is what a request asks to do. Service and PluginID are empty when the route
+// is not scoped to them, only grants without that restriction allow it. The plugin
+// of the routes loading from a form is not known before the form is parsed, loads
+// restricted to some plugins go through PUT /plugins/:id. The gateway routes are not
+// scoped to a plugin either.
+type Access struct {
+	Permission Permission
+	Service    string
+	PluginID   string
+}
+
+func (a Access) String() string {
+	target := "*"
+	if a.Service != "" {
+		target = a.Service
+	}
+	if a.PluginID != "" {
+		target += "/" + a.PluginID
+	}
+	return string(a.Permission) + " " + target
+}
+
+// Authorizer decides whether the identity authenticated for c, see AppIDOf, may
+// perform access.
+type Authorizer interface {
+	Authorize(c HttpContext, access Access) error
+}
+
+// Grant allows permissions on the services and plugins matching its patterns, in
+// the syntax of path.Match. Empty patterns match everything.
+type Grant struct {
+	Permissions []Permission `json:"permissions"`
+	Services    []string     `json:"services,omitempty"`
+	Plugins     []string     `json:"plugins,omitempty"`
+}
+
+func (g Grant) allows(access Access) bool {
+	if !slices.Contains(g.Permissions, access.Permission) && !slices.Contains(g.Permissions, PermAll) {
+		return false
+	}
+	return matchAny(g.Services, access.Service) && matchAny(g.Plugins, access.PluginID)
+}
+
+func matchAny(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RBACAuthorizer grants the permissions of named roles to app IDs.
+type RBACAuthorizer struct {
+	Roles map[string][]Grant `json:"roles"`
+	// Bindings maps an app ID to its roles.
+	Bindings map[string][]string `json:"bindings"`
+}
+
+func (r *RBACAuthorizer) Authorize(c HttpContext, access Access) error {
+	appID := AppIDOf(c)
+	if appID == "" {
+		return fmt.Errorf("no authenticated app to authorize %s", access)
+	}
+	for _, role := range r.Bindings[appID] {
+		for _, grant := range r.Roles[role] {
+			if grant.allows(access) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s is not allowed to %s", appID, access)
+}
+
+// readsPluginID reports whether route acts on the plugin of the plugin_id query.
+func readsPluginID(route Route) bool {
+	return slices.Contains(route.Query, "plugin_id") || slices.Contains(route.Params, "plugin_id")
+}
+
+func withAuthorization(route Route, authorizer Authorizer, errorWriter ErrorWriter) Handler {
+	if errorWriter == nil {
+		errorWriter = ErrorRet
+	}
+	return func(c HttpContext) {
+		var access Access
+		if route.Service {
+			access.Service = serviceOf(c)
+		}
+		switch {
+		case strings.Contains(route.Path, "/:id"):
+			// PUT /plugins/:id checks that meta.id is the one of the path.
+			access.PluginID = PathParam(c, "id")
+		case route.Body != RouteBodyMultipart && readsPluginID(route):
+			// The form routes load whatever meta.id they carry, whatever the query says,
+			// and routes that do not read plugin_id are not scoped by it.
+			access.PluginID = c.Query("plugin_id")
+		}
+		for _, permission := range route.Permissions {
+			access.Permission = permission
+			if err := authorizer.Authorize(c, access); err != nil {
+				errorWriter(c, fmt.Errorf("%w: %v", ErrForbidden, err))
+				return
+			}
+		}
+		route.handler(c)
+	}
+}
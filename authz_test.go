@@ -0,0 +1,127 @@
+package goplugify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRBACAuthorizer(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	server.SetStatusCodes(true)
+	for _, id := range []string{"diag-disk", "billing-job", "billing-report"} {
+		if c := putTestPlugin(t, server, id, LoaderTypeYaegiHTTP); c.status != 201 {
+			t.Fatalf("load %s: %d %v", id, c.status, c.resp)
+		}
+	}
+
+	auth := NewCredentialsHMACAuth(NewStaticCredentials(
+		&Credential{AppID: "oncall", Secrets: []Secret{{Secret: "s1"}}},
+		&Credential{AppID: "admin", Secrets: []Secret{{Secret: "s2"}}},
+		&Credential{AppID: "nobody", Secrets: []Secret{{Secret: "s3"}}},
+		&Credential{AppID: "deployer", Secrets: []Secret{{Secret: "s4"}}},
+	))
+	authorizer := &RBACAuthorizer{
+		Roles: map[string][]Grant{
+			"oncall": {
+				{Permissions: []Permission{PermList}, Services: []string{"default"}},
+				{Permissions: []Permission{PermRun}, Plugins: []string{"diag-*"}},
+			},
+			"admin":    {{Permissions: []Permission{PermAll}}},
+			"deployer": {{Permissions: []Permission{PermLoad}, Plugins: []string{"diag-*"}}},
+		},
+		Bindings: map[string][]string{"oncall": {"oncall"}, "admin": {"admin"}, "deployer": {"deployer"}},
+	}
+	mux := NewServeMuxRouter(nil)
+	router := WithAuthorizerHttpRouter(mux, auth, authorizer)
+	server.RegisterRoutes(router, "/api")
+	server.RegisterRoutesV2(router, "/api/v2")
+	server.RegisterGateway(router, "/api")
+	server.RegisterPluginUI(router, "/api")
+	server.AddRoute("GET", "/ping", func(c HttpContext) { c.JSON(200, "pong") })
+
+	nonce := 0
+	do := func(appID, secret, method, target string) (int, map[string]any) {
+		nonce++
+		signed := signedTestContext(appID, secret, fmt.Sprint("n", nonce), time.Now())
+		req := httptest.NewRequest(method, target, strings.NewReader("{}"))
+		for key, value := range signed.headers {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		var body map[string]any
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body
+	}
+
+	for _, tc := range []struct {
+		name, appID, secret, method, target string
+		status                              int
+	}{
+		{"run a diagnostic", "oncall", "s1", "POST", "/api/v2/plugins/diag-disk/run", 200},
+		{"run another plugin", "oncall", "s1", "POST", "/api/v2/plugins/billing-job/run", 403},
+		{"run a diagnostic with v1", "oncall", "s1", "POST", "/api/plugin/run?plugin_id=diag-disk", 200},
+		{"list the service", "oncall", "s1", "GET", "/api/plugin/list", 200},
+		{"list another service", "oncall", "s1", "GET", "/api/plugin/list?service=billing", 403},
+		{"unload a diagnostic", "oncall", "s1", "DELETE", "/api/v2/plugins/diag-disk", 403},
+		{"load", "oncall", "s1", "POST", "/api/plugin/load", 403},
+		{"components", "oncall", "s1", "GET", "/api/plugin/components", 403},
+		{"unbound app", "nobody", "s3", "GET", "/api/plugin/list", 403},
+		{"bad signature", "oncall", "s2", "GET", "/api/plugin/list", 401},
+		{"admin unload", "admin", "s2", "DELETE", "/api/v2/plugins/billing-job", 200},
+		{"unrestricted openapi", "nobody", "s3", "GET", "/api/openapi.json", 200},
+		// The form carries the plugin ID, the query cannot scope a legacy load.
+		{"scoped legacy load", "deployer", "s4", "POST", "/api/plugin/load?plugin_id=diag-x", 403},
+		{"scoped legacy init", "deployer", "s4", "POST", "/api/plugin/init?plugin_id=diag-x", 403},
+		{"scoped batch", "deployer", "s4", "POST", "/api/plugin/batch?plugin_id=diag-x", 403},
+		// Authorized, then refused for the missing content hash.
+		{"gateway mount without a role", "nobody", "s3", "GET", "/api/plugin/gw/ping", 403},
+		{"gateway mount", "admin", "s2", "GET", "/api/plugin/gw/ping", 200},
+		{"plugin UI without a role", "nobody", "s3", "GET", "/api/plugin/ui/diag-disk/index.html", 403},
+		{"scoped load by path", "deployer", "s4", "PUT", "/api/v2/plugins/diag-x", 401},
+		{"load outside the scope by path", "deployer", "s4", "PUT", "/api/v2/plugins/billing-x", 403},
+	} {
+		if status, body := do(tc.appID, tc.secret, tc.method, tc.target); status != tc.status {
+			t.Errorf("%s: expected %d, got %d: %v", tc.name, tc.status, status, body)
+		}
+	}
+
+	// The job of another plugin is not found through a plugin the app may run, and
+	// the gateway is not scoped by plugin_id.
+	status, body := do("admin", "s2", "POST", "/api/plugin/run?plugin_id=billing-report&async=true")
+	jobID, _ := body["id"].(string)
+	if status != 202 || jobID == "" {
+		t.Fatalf("async run: %d %v", status, body)
+	}
+	for _, tc := range []struct {
+		name, target string
+		status       int
+	}{
+		{"job of another plugin", "/api/plugin/job?id=" + jobID + "&plugin_id=diag-disk", 404},
+		{"job without a plugin", "/api/plugin/job?id=" + jobID, 403},
+		{"cancel the job of another plugin", "/api/plugin/job/cancel?id=" + jobID + "&plugin_id=diag-disk", 404},
+		{"gateway mount scoped by the query", "/api/plugin/gw/ping?plugin_id=diag-disk", 403},
+		{"gateway scoped by the query", "/api/plugin/gateway?path=ping&plugin_id=diag-disk", 403},
+	} {
+		method := "GET"
+		if strings.Contains(tc.target, "cancel") || strings.Contains(tc.target, "gateway?") {
+			method = "POST"
+		}
+		if status, body := do("oncall", "s1", method, tc.target); status != tc.status {
+			t.Errorf("%s: expected %d, got %d: %v", tc.name, tc.status, status, body)
+		}
+	}
+
+	status, body = do("oncall", "s1", "DELETE", "/api/v2/plugins/diag-disk")
+	if apiErr, _ := body["error"].(map[string]any); status != 403 || apiErr["code"] != string(CodeForbidden) {
+		t.Errorf("expected the forbidden envelope on v2, got %d %v", status, body)
+	}
+	status, body = do("oncall", "s1", "POST", "/api/plugin/unload?plugin_id=diag-disk")
+	if msg, _ := body["error"].(string); status != 403 || !strings.Contains(msg, "oncall is not allowed to unload default/diag-disk") {
+		t.Errorf("expected the legacy error on v1, got %d %v", status, body)
+	}
+}
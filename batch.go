@@ -0,0 +1,280 @@
+package goplugify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+type ChangeAction string
+
+const (
+	ChangeLoad   ChangeAction = "load"
+	ChangeUnload ChangeAction = "unload"
+)
+
+// Change is one step of a batch applied with Applier.Apply.
+type Change struct {
+	Action ChangeAction `json:"action"`
+	// Meta describes the plugin to load.
+	Meta *Meta `json:"meta,omitempty"`
+	// PluginID is the plugin to unload.
+	PluginID string `json:"plugin_id,omitempty"`
+	// File names the multipart field holding the artifact of a load sent to
+	// POST /plugin/batch, the plugin ID when empty.
+	File string `json:"file,omitempty"`
+	// Assets names the multipart field holding the assets bundle of a load sent to
+	// POST /plugin/batch, the load has none when empty.
+	Assets string `json:"assets,omitempty"`
+	// URL is the location of the artifact for the file loaders. POST /plugin/batch
+	// only accepts it once enabled with HTTPServer.SetBatchURLs.
+	URL string `json:"url,omitempty"`
+	// ContentHash is the hex SHA-256 of the artifact uploaded as File. It is required
+	// when the batch is signed, the signed content hash then covers the changes.
+	ContentHash string `json:"content_hash,omitempty"`
+	// AssetsHash is the hex SHA-256 of the assets bundle of the change.
+	AssetsHash string `json:"assets_hash,omitempty"`
+
+	// Source is handed to the loader, as src of LoadPlugin.
+	Source any `json:"-"`
+}
+
+func (c Change) pluginID() string {
+	if c.Action == ChangeLoad && c.Meta != nil {
+		return c.Meta.ID
+	}
+	return c.PluginID
+}
+
+// Apply applies changes as a whole. Every new version is loaded and initialized
+// before anything is touched, then the plugins to unload are destroyed and all
+// changes are swapped in together. When a step fails the prepared versions are
+// destroyed, the plugins destroyed so far are initialized again, and the manager is
+// left as it was. It returns the loaded plugins in the order of changes.
+func (manager *PluginManager) Apply(ctx context.Context, changes []Change) ([]IPlugin, error) {
+	manager.changeLock.Lock()
+	defer manager.changeLock.Unlock()
+
+	seen := make(map[string]bool)
+	for i, change := range changes {
+		id := change.pluginID()
+		switch change.Action {
+		case ChangeLoad:
+			if _, err := manager.loaderOf(change.Meta); err != nil {
+				return nil, WrapError(CodeInvalidRequest, "apply", id, fmt.Errorf("change %d: %w", i, err))
+			}
+		case ChangeUnload:
+			if _, ok := manager.plugins.Get(id); !ok {
+				return nil, WrapError(CodeNotFound, "apply", id, fmt.Errorf("change %d: %w", i, ErrPluginNotFound))
+			}
+		default:
+			return nil, NewCodeError(CodeInvalidRequest, fmt.Sprintf("change %d: invalid action %q", i, change.Action))
+		}
+		if seen[id] {
+			return nil, NewCodeError(CodeInvalidRequest, fmt.Sprintf("change %d: plugin %s is changed twice", i, id))
+		}
+		seen[id] = true
+	}
+
+	prepared := make([]IPlugin, len(changes))
+	rollback := func() {
+		for _, plugin := range prepared {
+			if plugin == nil {
+				continue
+			}
+			if err := plugin.OnDestroy(ctx); err != nil {
+				manager.components.Logger.Error("rollback of plugin %s: destroy prepared version: %v", plugin.Meta().ID, err)
+			}
+		}
+	}
+	for i, change := range changes {
+		if change.Action != ChangeLoad {
+			continue
+		}
+		plugin, err := manager.prepare(change.Meta, change.Source)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		prepared[i] = plugin
+	}
+
+	var destroyed []IPlugin
+	for _, change := range changes {
+		if change.Action != ChangeUnload {
+			continue
+		}
+		plugin, _ := manager.plugins.Get(change.PluginID)
+		manager.unwatch(change.PluginID)
+		if err := plugin.OnDestroy(ctx); err != nil {
+			manager.watch(plugin)
+			for _, restore := range destroyed {
+				if err := restore.OnInit(manager.components); err != nil {
+					manager.components.Logger.Error("rollback of plugin %s: init: %v", restore.Meta().ID, err)
+				}
+				manager.watch(restore)
+			}
+			rollback()
+			return nil, WrapError(CodeDestroyFailed, "unload", change.PluginID, err)
+		}
+		destroyed = append(destroyed, plugin)
+	}
+
+	loaded := make([]IPlugin, 0, len(changes))
+	for i, change := range changes {
+		if change.Action == ChangeUnload {
+			manager.plugins.Remove(change.PluginID)
+			delete(manager.previous, change.PluginID)
+			continue
+		}
+		loaded = append(loaded, manager.swapIn(prepared[i]))
+	}
+	return loaded, nil
+}
+
+// batchFileContext is the source of one load of a batch, it exposes the multipart
+// fields of the change as the "file" and "assets" fields the HTTP loaders read.
+type batchFileContext struct {
+	HttpContext
+	field       string
+	assetsField string
+	contentHash string
+	assetsHash  string
+}
+
+// Value gives the hashes of the change as the signed hashes of the upload.
+func (c *batchFileContext) Value(key any) any {
+	switch key {
+	case ContentHashKey:
+		return c.contentHash
+	case AssetsHashKey:
+		return c.assetsHash
+	}
+	return c.HttpContext.Value(key)
+}
+
+func (c *batchFileContext) FormFile(name string) (*multipart.FileHeader, error) {
+	switch name {
+	case "file":
+		name = c.field
+	case "assets":
+		if c.assetsField == "" {
+			return nil, http.ErrMissingFile
+		}
+		name = c.assetsField
+	}
+	return c.HttpContext.FormFile(name)
+}
+
+// GetHeader hides the length of the whole batch, each artifact is checked on its own.
+func (c *batchFileContext) GetHeader(key string) string {
+	if strings.EqualFold(key, "Content-Length") {
+		return ""
+	}
+	return c.HttpContext.GetHeader(key)
+}
+
+func (c *batchFileContext) Body() io.ReadCloser {
+	return io.NopCloser(strings.NewReader(""))
+}
+
+// SetBatchURLs lets the loads of POST /plugin/batch name their artifact by URL,
+// file:// paths and http(s):// locations read by the server. It is disabled by default.
+func (server *HTTPServer) SetBatchURLs(enabled bool) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.batchURLs = enabled
+}
+
+func (server *HTTPServer) batchURLsEnabled() bool {
+	server.lock.RLock()
+	defer server.lock.RUnlock()
+	return server.batchURLs
+}
+
+// Batch applies the changes of the "changes" form field, a JSON array of Change,
+// all or none. Artifacts are sent as multipart files named by the File of each
+// change, and their assets bundles as the ones named by Assets.
+// A signed content hash is the SHA-256 of the "changes" field.
+func (server *HTTPServer) Batch(c HttpContext) {
+	manager, err := server.getManager(c)
+	if err != nil {
+		ErrorRet(c, err)
+		return
+	}
+	applier, ok := manager.(Applier)
+	if !ok {
+		ErrorRet(c, NewCodeError(CodeInvalidRequest, "batches are not supported by the service"))
+		return
+	}
+
+	changesJSON, err := formValue(c, "changes")
+	if err != nil {
+		ErrorRet(c, err)
+		return
+	}
+	if changesJSON == "" {
+		ErrorRet(c, errMissingParam("changes"))
+		return
+	}
+	signed := ContentHashOf(c)
+	if signed != "" {
+		sum := sha256.Sum256([]byte(changesJSON))
+		if !strings.EqualFold(hex.EncodeToString(sum[:]), signed) {
+			ErrorRet(c, ErrContentHashMismatch)
+			return
+		}
+	}
+	var changes []Change
+	if err := json.Unmarshal([]byte(changesJSON), &changes); err != nil {
+		ErrorRet(c, &PlugifyError{Code: CodeInvalidRequest, message: "invalid changes", Err: err})
+		return
+	}
+	for i := range changes {
+		change := &changes[i]
+		if change.Action != ChangeLoad {
+			continue
+		}
+		if change.URL != "" {
+			// The server would fetch any location on behalf of the client.
+			if !server.batchURLsEnabled() {
+				ErrorRet(c, NewCodeError(CodeInvalidRequest, fmt.Sprintf("change %d: url sources are disabled", i)))
+				return
+			}
+			change.Source = change.URL
+			continue
+		}
+		if signed != "" && change.ContentHash == "" {
+			ErrorRet(c, NewCodeError(CodeInvalidRequest, fmt.Sprintf("change %d: content_hash is required", i)))
+			return
+		}
+		field := change.File
+		if field == "" {
+			field = change.pluginID()
+		}
+		change.Source = &batchFileContext{
+			HttpContext: c,
+			field:       field,
+			assetsField: change.Assets,
+			contentHash: change.ContentHash,
+			assetsHash:  change.AssetsHash,
+		}
+	}
+
+	plugins, err := applier.Apply(c, changes)
+	if err != nil {
+		ErrorRet(c, prefixError("apply batch error", err))
+		return
+	}
+	metas := make([]*Meta, 0, len(plugins))
+	for _, plugin := range plugins {
+		metas = append(metas, plugin.Meta())
+	}
+	c.JSON(200, metas)
+}
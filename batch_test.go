@@ -0,0 +1,159 @@
+package goplugify
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func scriptSource(script string) *testContext {
+	c := newTestContext()
+	c.body = []byte(script)
+	return c
+}
+
+func TestApplyBatch(t *testing.T) {
+	manager := InitPluginManagers("default")["default"].(*PluginManager)
+	ctx := context.Background()
+
+	plugins, err := manager.Apply(ctx, []Change{
+		{Action: ChangeLoad, Meta: &Meta{ID: "a", Loader: LoaderTypeYaegiHTTP}, Source: scriptSource(testScript)},
+		{Action: ChangeLoad, Meta: &Meta{ID: "b", Loader: LoaderTypeYaegiHTTP}, Source: scriptSource(testScript)},
+	})
+	if err != nil || len(plugins) != 2 {
+		t.Fatalf("apply: %v %v", plugins, err)
+	}
+	a, _ := manager.GetPlugin("a")
+	hash := a.(*YaegiPlugin).ContentHash
+
+	upgraded := strings.Replace(testScript, `"ran"`, `"ran v2"`, 1)
+	_, err = manager.Apply(ctx, []Change{
+		{Action: ChangeLoad, Meta: &Meta{ID: "a", Loader: LoaderTypeYaegiHTTP}, Source: scriptSource(upgraded)},
+		{Action: ChangeUnload, PluginID: "b"},
+		{Action: ChangeLoad, Meta: &Meta{ID: "c", Loader: LoaderTypeYaegiHTTP}, Source: scriptSource("package main\nfunc Run(")},
+	})
+	if CodeOf(err) != CodeInitFailed {
+		t.Fatalf("expected init_failed, got %v", err)
+	}
+	if resp, _ := a.OnRun(nil); resp != "ran" || a.(*YaegiPlugin).ContentHash != hash {
+		t.Errorf("plugin a changed by a failed batch: %v", resp)
+	}
+	if _, err := manager.GetPlugin("b"); err != nil {
+		t.Errorf("plugin b unloaded by a failed batch: %v", err)
+	}
+	if _, err := manager.GetPlugin("c"); err == nil {
+		t.Error("plugin c loaded by a failed batch")
+	}
+
+	_, err = manager.Apply(ctx, []Change{
+		{Action: ChangeLoad, Meta: &Meta{ID: "a", Loader: LoaderTypeYaegiHTTP}, Source: scriptSource(upgraded)},
+		{Action: ChangeUnload, PluginID: "b"},
+	})
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if resp, _ := a.OnRun(nil); resp != "ran v2" {
+		t.Errorf("expected plugin a upgraded, got %v", resp)
+	}
+	if _, err := manager.GetPlugin("b"); err == nil {
+		t.Error("expected plugin b unloaded")
+	}
+
+	_, err = manager.Apply(ctx, []Change{
+		{Action: ChangeUnload, PluginID: "a"},
+		{Action: ChangeUnload, PluginID: "a"},
+	})
+	if CodeOf(err) != CodeInvalidRequest {
+		t.Errorf("expected invalid_request for a plugin changed twice, got %v", err)
+	}
+}
+
+func TestBatchRoute(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	script := filepath.Join(t.TempDir(), "plugin.go")
+	if err := os.WriteFile(script, []byte(testScript), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newStatusTestContext()
+	c.form["changes"] = `[{"action": "load", "meta": {"id": "demo", "loader": "yaegi_file"}, "url": "file://` + script + `"}]`
+	server.Batch(c)
+	if c.status != 400 {
+		t.Fatalf("expected url sources to be refused by default, got %d: %v", c.status, c.resp)
+	}
+
+	server.SetBatchURLs(true)
+	c = newTestContext()
+	c.form["changes"] = `[{"action": "load", "meta": {"id": "demo", "loader": "yaegi_file"}, "url": "file://` + script + `"}]`
+	server.Batch(c)
+	var metas []Meta
+	c.decode(t, &metas)
+	if c.status != 200 || len(metas) != 1 || metas[0].ID != "demo" {
+		t.Fatalf("unexpected batch response %d: %v", c.status, c.resp)
+	}
+
+	c = newStatusTestContext()
+	c.form["changes"] = `[{"action": "restart", "plugin_id": "demo"}]`
+	server.Batch(c)
+	if c.status != 400 {
+		t.Errorf("expected 400 for an invalid action, got %d: %v", c.status, c.resp)
+	}
+}
+
+func TestBatchAssets(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	router := NewServeMuxRouter(nil)
+	server.RegisterRoutes(router, "/api")
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("changes", `[
+		{"action": "load", "meta": {"id": "a", "loader": "yaegi_http"}, "assets": "a-assets"},
+		{"action": "load", "meta": {"id": "b", "loader": "yaegi_http"}, "assets": "b-assets"},
+		{"action": "load", "meta": {"id": "c", "loader": "yaegi_http"}}
+	]`)
+	for _, id := range []string{"a", "b", "c"} {
+		fw, _ := mw.CreateFormFile(id, id+".go")
+		fw.Write([]byte(testScript))
+	}
+	for _, field := range []string{"a-assets", "b-assets", "assets"} {
+		aw, _ := mw.CreateFormFile(field, field+".zip")
+		zw := zip.NewWriter(aw)
+		w, _ := zw.Create("index.html")
+		w.Write([]byte(field))
+		zw.Close()
+	}
+	mw.Close()
+	resp, err := http.Post(ts.URL+"/api/plugin/batch", mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("batch: %d", resp.StatusCode)
+	}
+
+	manager := server.Registry().managers["default"]
+	for id, want := range map[string]string{"a": "a-assets", "b": "b-assets", "c": ""} {
+		plugin, _ := manager.GetPlugin(id)
+		assets := plugin.(AssetsProvider).Assets()
+		var got string
+		if assets != nil {
+			data, _ := fs.ReadFile(assets, "index.html")
+			got = string(data)
+		}
+		if got != want {
+			t.Errorf("expected plugin %s to have the assets %q, got %q", id, want, got)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+// Package client calls the management API registered by HTTPServer.RegisterRoutes,
+// signing every request the way goplugify.HMACAuth expects.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	goplugify "github.com/go-plugify/go-plugify"
+)
+
+var (
+	DefaultRetries   = 2
+	DefaultRetryWait = 200 * time.Millisecond
+)
+
+type Client struct {
+	// BaseURL is the server address followed by the route prefix, such as
+	// http://localhost:8080/api.
+	BaseURL   string
+	AppID     string
+	AppSecret string
+	// V2URL is the prefix of the routes of RegisterRoutesV2, used to call methods,
+	// BaseURL followed by /v2 when empty.
+	V2URL string
+	// Service selects the plugin manager, the server uses default when empty.
+	Service string
+	// SignVersion is the version of the request signatures, goplugify.SignVersion2
+	// when zero. Servers predating it need goplugify.SignVersion1.
+	SignVersion int
+
+	HTTPClient *http.Client
+	// Retries is the number of times a GET request is retried after a network
+	// error or a 502, 503 or 504. Loads, unloads and runs are never retried.
+	Retries   int
+	RetryWait time.Duration
+}
+
+func New(baseURL, appID, appSecret string) *Client {
+	return &Client{
+		BaseURL:    baseURL,
+		AppID:      appID,
+		AppSecret:  appSecret,
+		HTTPClient: http.DefaultClient,
+		Retries:    DefaultRetries,
+		RetryWait:  DefaultRetryWait,
+	}
+}
+
+// WithService returns a copy of c calling the plugin manager of service.
+func (c *Client) WithService(service string) *Client {
+	copied := *c
+	copied.Service = service
+	return &copied
+}
+
+// Error is an error answered by the server. Code comes from the error envelope of
+// the server when there is one, from the status otherwise. The original routes
+// answer 500 unless the server enables goplugify.HTTPServer.SetStatusCodes.
+type Error struct {
+	StatusCode int
+	Code       goplugify.ErrorCode
+	Message    string
+	Details    any
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("go-plugify: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// CodeOf returns the code of the Error in the chain of err, CodeUnknown if none.
+func CodeOf(err error) goplugify.ErrorCode {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return goplugify.CodeUnknown
+}
+
+var statusCodes = map[int]goplugify.ErrorCode{
+	400: goplugify.CodeInvalidRequest,
+	401: goplugify.CodeUnauthorized,
+	403: goplugify.CodeForbidden,
+	404: goplugify.CodeNotFound,
+	409: goplugify.CodeConflict,
+	413: goplugify.CodeTooLarge,
+	499: goplugify.CodeCanceled,
+	503: goplugify.CodeUnavailable,
+	504: goplugify.CodeTimeout,
+}
+
+func decodeError(resp *http.Response, body []byte) error {
+	e := &Error{StatusCode: resp.StatusCode, Code: goplugify.CodeUnknown, Message: http.StatusText(resp.StatusCode)}
+	if code, ok := statusCodes[resp.StatusCode]; ok {
+		e.Code = code
+	}
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &envelope) != nil || len(envelope.Error) == 0 {
+		return e
+	}
+	// The original routes answer {"error": "message"}, the v2 ones an APIError.
+	var apiErr goplugify.APIError
+	if json.Unmarshal(envelope.Error, &e.Message) != nil && json.Unmarshal(envelope.Error, &apiErr) == nil {
+		e.Code, e.Message, e.Details = apiErr.Code, apiErr.Message, apiErr.Details
+	}
+	return e
+}
+
+// Sign sets the authentication headers of req. contentHash is the hex SHA-256 of
+// the uploaded artifact, empty for other requests.
+func (c *Client) Sign(req *http.Request, contentHash string) {
+	version := c.SignVersion
+	if version == 0 {
+		version = goplugify.SignVersion2
+	}
+	goplugify.SignRequest(req, version, c.AppID, c.AppSecret, contentHash)
+}
+
+type request struct {
+	// base replaces BaseURL.
+	base        string
+	method      string
+	path        string
+	query       url.Values
+	contentType string
+	body        []byte
+	contentHash string
+	// headers are set before signing.
+	headers    map[string]string
+	idempotent bool
+}
+
+// do sends r and decodes a successful response into out, a *[]byte receives the
+// body as is.
+func (c *Client) do(ctx context.Context, r request, out any) error {
+	query := r.query
+	if query == nil {
+		query = url.Values{}
+	}
+	if c.Service != "" {
+		query.Set("service", c.Service)
+	}
+	base := r.base
+	if base == "" {
+		base = c.BaseURL
+	}
+	target := base + r.path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	retries := 0
+	if r.idempotent {
+		retries = c.Retries
+	}
+	for attempt := 0; ; attempt++ {
+		resp, body, err := c.send(ctx, r, target)
+		retry := err != nil || resp.StatusCode == 502 || resp.StatusCode == 503 || resp.StatusCode == 504
+		if retry && attempt < retries && ctx.Err() == nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.RetryWait << attempt):
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode >= 300 {
+			return decodeError(resp, body)
+		}
+		if raw, ok := out.(*[]byte); ok {
+			*raw = body
+			return nil
+		}
+		if out == nil || len(body) == 0 {
+			return nil
+		}
+		return json.Unmarshal(body, out)
+	}
+}
+
+func (c *Client) send(ctx context.Context, r request, target string) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, r.method, target, bytes.NewReader(r.body))
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.contentType != "" {
+		req.Header.Set("Content-Type", r.contentType)
+	}
+	for key, value := range r.headers {
+		req.Header.Set(key, value)
+	}
+	c.Sign(req, r.contentHash)
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp, body, err
+}
+
+// Load loads or upgrades the plugin described by meta from the artifact, a Go
+// script or a compiled native plugin depending on meta.Loader.
+func (c *Client) Load(ctx context.Context, meta *goplugify.Meta, artifact []byte) (*goplugify.Meta, error) {
+	return c.LoadBundle(ctx, meta, artifact, nil)
+}
+
+// LoadFile loads or upgrades the plugin described by meta from the artifact at path.
+func (c *Client) LoadFile(ctx context.Context, meta *goplugify.Meta, path string) (*goplugify.Meta, error) {
+	artifact, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.load(ctx, meta, filepath.Base(path), artifact, nil)
+}
+
+// LoadBundle loads or upgrades a plugin along with assets, a zip of the files
+// served under /plugin/ui/{id}/.
+func (c *Client) LoadBundle(ctx context.Context, meta *goplugify.Meta, artifact, assets []byte) (*goplugify.Meta, error) {
+	return c.load(ctx, meta, meta.ID, artifact, assets)
+}
+
+func (c *Client) load(ctx context.Context, meta *goplugify.Meta, filename string, artifact, assets []byte) (*goplugify.Meta, error) {
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("meta", string(metaJSON))
+	fw, _ := mw.CreateFormFile("file", filename)
+	fw.Write(artifact)
+	if assets != nil {
+		aw, _ := mw.CreateFormFile("assets", "assets.zip")
+		aw.Write(assets)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{"X-Go-Plugify-Meta-Hash": sha256Hex(metaJSON)}
+	if assets != nil {
+		headers["X-Go-Plugify-Assets-Hash"] = sha256Hex(assets)
+	}
+	loaded := new(goplugify.Meta)
+	err = c.do(ctx, request{
+		method:      "POST",
+		path:        "/plugin/load",
+		contentType: mw.FormDataContentType(),
+		body:        body.Bytes(),
+		contentHash: sha256Hex(artifact),
+		headers:     headers,
+	}, loaded)
+	if err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
+
+// Run runs a plugin with input encoded as the JSON body and decodes its result into
+// out. A *[]byte out receives the response body as is, for plugins answering with
+// a goplugify.Response.
+func (c *Client) Run(ctx context.Context, pluginID string, input, out any) error {
+	var body []byte
+	if input != nil {
+		var err error
+		if body, err = json.Marshal(input); err != nil {
+			return err
+		}
+	}
+	return c.do(ctx, request{
+		method:      "POST",
+		path:        "/plugin/run",
+		query:       url.Values{"plugin_id": {pluginID}},
+		contentType: "application/json",
+		body:        body,
+	}, out)
+}
+
+// Call calls a method exported by a plugin, the way Run does.
+func (c *Client) Call(ctx context.Context, pluginID, method string, input, out any) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	base := c.V2URL
+	if base == "" {
+		base = c.BaseURL + "/v2"
+	}
+	return c.do(ctx, request{
+		base:        base,
+		method:      "POST",
+		path:        "/plugins/" + url.PathEscape(pluginID) + "/methods/" + url.PathEscape(method),
+		contentType: "application/json",
+		body:        body,
+	}, out)
+}
+
+// PluginPage is a page of List, NextCursor is empty on the last page.
+type PluginPage struct {
+	Plugins    []*goplugify.Plugin `json:"plugins"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+// List lists the plugins matching opts, a page of opts.Limit plugins when set.
+func (c *Client) List(ctx context.Context, opts goplugify.ListOptions) (*PluginPage, error) {
+	query := url.Values{}
+	for key, value := range map[string]string{
+		"loader": string(opts.Loader), "author": opts.Author, "state": string(opts.State),
+		"tag": opts.Tag, "prefix": opts.Prefix, "sort": opts.Sort, "cursor": opts.Cursor,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if opts.Desc {
+		query.Set("order", "desc")
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	r := request{method: "GET", path: "/plugin/list", query: query, idempotent: true}
+	page := new(PluginPage)
+	if opts.Limit > 0 || opts.Cursor != "" {
+		err := c.do(ctx, r, page)
+		return page, err
+	}
+	err := c.do(ctx, r, &page.Plugins)
+	return page, err
+}
+
+// Get returns a plugin with its exported methods.
+func (c *Client) Get(ctx context.Context, pluginID string) (*goplugify.PluginDetail, error) {
+	detail := new(goplugify.PluginDetail)
+	err := c.do(ctx, request{
+		method:     "GET",
+		path:       "/plugin/get",
+		query:      url.Values{"plugin_id": {pluginID}},
+		idempotent: true,
+	}, detail)
+	if err != nil {
+		return nil, err
+	}
+	return detail, nil
+}
+
+func (c *Client) Unload(ctx context.Context, pluginID string) error {
+	return c.do(ctx, request{
+		method: "POST",
+		path:   "/plugin/unload",
+		query:  url.Values{"plugin_id": {pluginID}},
+	}, nil)
+}
+
+// Rollback restores the version a plugin had before its last upgrade.
+func (c *Client) Rollback(ctx context.Context, pluginID string) (*goplugify.Meta, error) {
+	meta := new(goplugify.Meta)
+	err := c.do(ctx, request{
+		method: "POST",
+		path:   "/plugin/rollback",
+		query:  url.Values{"plugin_id": {pluginID}},
+	}, meta)
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// Services lists the services of the server.
+func (c *Client) Services(ctx context.Context) ([]goplugify.ServiceInfo, error) {
+	var services []goplugify.ServiceInfo
+	err := c.do(ctx, request{method: "GET", path: "/plugin/services", idempotent: true}, &services)
+	return services, err
+}
+
+// Components lists the components plugins of the service can use.
+func (c *Client) Components(ctx context.Context) (goplugify.PluginComponentItems, error) {
+	var items goplugify.PluginComponentItems
+	err := c.do(ctx, request{method: "GET", path: "/plugin/components", idempotent: true}, &items)
+	return items, err
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
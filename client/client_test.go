@@ -0,0 +1,179 @@
+package client
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	goplugify "github.com/go-plugify/go-plugify"
+)
+
+const testScript = `package main
+
+func Run(input map[string]any) (any, error) {
+	return map[string]any{"echo": input["body"]}, nil
+}
+
+func Methods() map[string]func(any) any {
+	return map[string]func(any) any{
+		"ping": func(input any) any { return "pong" },
+	}
+}
+
+func Destroy(input map[string]any) error {
+	return nil
+}
+`
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := goplugify.InitHTTPServer(goplugify.InitPluginManagers("default"))
+	server.SetStatusCodes(true)
+	mux := goplugify.NewServeMuxRouter(nil)
+	auth := goplugify.NewHMACAuth("tool", "secret")
+	auth.MinSignVersion = goplugify.SignVersion2
+	router := goplugify.WithAuthHttpRouter(mux, auth)
+	server.RegisterRoutes(router, "/api")
+	server.RegisterPluginUI(mux, "/api")
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestClient(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	c := New(ts.URL+"/api", "tool", "secret")
+
+	meta, err := c.Load(ctx, &goplugify.Meta{ID: "echo", Loader: goplugify.LoaderTypeYaegiHTTP, Tags: []string{"demo"}}, []byte(testScript))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if meta.ID != "echo" {
+		t.Errorf("unexpected meta %+v", meta)
+	}
+
+	var result struct {
+		Echo map[string]any `json:"echo"`
+	}
+	if err := c.Run(ctx, "echo", map[string]any{"n": 1}, &result); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if result.Echo["n"] != float64(1) {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	path := filepath.Join(t.TempDir(), "second.go")
+	os.WriteFile(path, []byte(testScript), 0o644)
+	if _, err := c.LoadFile(ctx, &goplugify.Meta{ID: "second", Loader: goplugify.LoaderTypeYaegiHTTP}, path); err != nil {
+		t.Fatalf("load file: %v", err)
+	}
+
+	var bundle bytes.Buffer
+	zw := zip.NewWriter(&bundle)
+	fw, _ := zw.Create("index.html")
+	fw.Write([]byte("<h1>ui</h1>"))
+	zw.Close()
+	if _, err := c.LoadBundle(ctx, &goplugify.Meta{ID: "ui", Loader: goplugify.LoaderTypeYaegiHTTP}, []byte(testScript), bundle.Bytes()); err != nil {
+		t.Fatalf("load bundle: %v", err)
+	}
+	resp, err := http.Get(ts.URL + "/api/plugin/ui/ui/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected the bundle to be served, got %d", resp.StatusCode)
+	}
+
+	page, err := c.List(ctx, goplugify.ListOptions{})
+	if err != nil || len(page.Plugins) != 3 || page.Plugins[0].MetaInfo.ID != "echo" {
+		t.Fatalf("unexpected list %+v: %v", page, err)
+	}
+	page, err = c.List(ctx, goplugify.ListOptions{Limit: 2})
+	if err != nil || len(page.Plugins) != 2 || page.NextCursor == "" {
+		t.Fatalf("unexpected page %+v: %v", page, err)
+	}
+	page, err = c.List(ctx, goplugify.ListOptions{Limit: 2, Cursor: page.NextCursor})
+	if err != nil || len(page.Plugins) != 1 || page.Plugins[0].MetaInfo.ID != "ui" {
+		t.Fatalf("unexpected last page %+v: %v", page, err)
+	}
+
+	detail, err := c.Get(ctx, "echo")
+	if err != nil || len(detail.Methods) != 1 || detail.Methods[0] != "ping" || detail.Meta.Tags[0] != "demo" {
+		t.Fatalf("unexpected detail %+v: %v", detail, err)
+	}
+
+	components, err := c.Components(ctx)
+	if err != nil || len(components) == 0 {
+		t.Fatalf("unexpected components %v: %v", components, err)
+	}
+
+	if err := c.Unload(ctx, "echo"); err != nil {
+		t.Fatalf("unload: %v", err)
+	}
+	err = c.Run(ctx, "echo", nil, nil)
+	if CodeOf(err) != goplugify.CodeNotFound {
+		t.Errorf("expected not found after unload, got %v", err)
+	}
+	if _, err := c.WithService("missing").Components(ctx); CodeOf(err) != goplugify.CodeNotFound {
+		t.Errorf("expected an unknown service to be not found, got %v", err)
+	}
+	if _, err := New(ts.URL+"/api", "tool", "wrong").Components(ctx); CodeOf(err) != goplugify.CodeUnauthorized {
+		t.Errorf("expected a wrong secret to be unauthorized, got %v", err)
+	}
+	legacy := New(ts.URL+"/api", "tool", "secret")
+	legacy.SignVersion = goplugify.SignVersion1
+	if _, err := legacy.Components(ctx); CodeOf(err) != goplugify.CodeUnauthorized {
+		t.Errorf("expected a v1 signature to be refused by the server requiring v2, got %v", err)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	ts := newTestServer(t)
+	var calls atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(503)
+			return
+		}
+		req, _ := http.NewRequest(r.Method, ts.URL+r.URL.String(), r.Body)
+		req.Header = r.Header
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			w.WriteHeader(502)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer flaky.Close()
+
+	c := New(flaky.URL+"/api", "tool", "secret")
+	c.RetryWait = 0
+	if components, err := c.Components(context.Background()); err != nil || len(components) == 0 {
+		t.Fatalf("expected the request to succeed after retries: %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls.Load())
+	}
+
+	calls.Store(0)
+	err := c.Run(context.Background(), "echo", nil, nil)
+	if CodeOf(err) != goplugify.CodeUnavailable || calls.Load() != 1 {
+		t.Errorf("expected runs not to be retried, got %v after %d calls", err, calls.Load())
+	}
+	calls.Store(0)
+	err = c.Unload(context.Background(), "echo")
+	if CodeOf(err) != goplugify.CodeUnavailable || calls.Load() != 1 {
+		t.Errorf("expected unloads not to be retried, got %v after %d calls", err, calls.Load())
+	}
+}
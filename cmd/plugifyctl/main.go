@@ -0,0 +1,424 @@
+// Command plugifyctl manages the plugins of running go-plugify hosts.
+//
+//	plugifyctl [-profile name] [-host url,...] [-service name,...] [-o table|json] <command> [flags] [args]
+//
+// Every command runs against each host and service, credentials come from a
+// profile of the config file or from PLUGIFY_APP_ID and PLUGIFY_APP_SECRET.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	goplugify "github.com/go-plugify/go-plugify"
+	"github.com/go-plugify/go-plugify/client"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, c *client.Client, fs *flag.FlagSet, args []string) (any, error)
+	// flags declares the flags of the command, read by run after parsing.
+	flags func(fs *flag.FlagSet)
+	// header and rows render the results as a table.
+	header []string
+	rows   func(result any) [][]string
+}
+
+var commands = map[string]*command{
+	"load": {
+		usage: "load [-id id] [-loader type] [-meta meta.json] [-assets ui.zip] <file>",
+		flags: func(fs *flag.FlagSet) {
+			fs.String("id", "", "plugin ID, the file name without extension by default")
+			fs.String("loader", "", "loader type, native_plugin_http for .so files and yaegi_http otherwise by default")
+			fs.String("meta", "", "JSON file holding the plugin meta")
+			fs.String("assets", "", "zip of the UI assets of the plugin")
+		},
+		run:    loadCommand,
+		header: []string{"ID", "VERSION", "LOADER"},
+		rows: func(result any) [][]string {
+			meta := result.(*goplugify.Meta)
+			return [][]string{{meta.ID, meta.Version, string(meta.Loader)}}
+		},
+	},
+	"list": {
+		usage: "list [-loader type] [-author name] [-state state] [-tag tag] [-prefix prefix] [-sort key] [-desc] [-limit n] [-cursor cursor]",
+		flags: func(fs *flag.FlagSet) {
+			for _, name := range []string{"loader", "author", "state", "tag", "prefix", "sort", "cursor"} {
+				fs.String(name, "", "filter or page by "+name)
+			}
+			fs.Bool("desc", false, "sort in descending order")
+			fs.Int("limit", 0, "page size")
+		},
+		run:    listCommand,
+		header: []string{"ID", "VERSION", "LOADER", "STATE", "RUNS", "LAST RUN"},
+		rows: func(result any) [][]string {
+			var rows [][]string
+			for _, p := range result.(*client.PluginPage).Plugins {
+				lastRun := "-"
+				if !p.RunTime.IsZero() {
+					lastRun = p.RunTime.Format(time.RFC3339)
+				}
+				rows = append(rows, []string{p.MetaInfo.ID, p.MetaInfo.Version, string(p.MetaInfo.Loader), string(p.State), strconv.Itoa(p.RunTimes), lastRun})
+			}
+			return rows
+		},
+	},
+	"get": {
+		usage: "get <plugin id>",
+		run: func(ctx context.Context, c *client.Client, fs *flag.FlagSet, args []string) (any, error) {
+			return c.Get(ctx, args[0])
+		},
+		header: []string{"ID", "VERSION", "LOADER", "STATE", "RUNS", "METHODS"},
+		rows: func(result any) [][]string {
+			d := result.(*goplugify.PluginDetail)
+			return [][]string{{d.Meta.ID, d.Meta.Version, string(d.Meta.Loader), string(d.State), strconv.Itoa(d.RunTimes), strings.Join(d.Methods, ",")}}
+		},
+	},
+	"run": {
+		usage: "run [-input json|@file] <plugin id>",
+		flags: inputFlag,
+		run: func(ctx context.Context, c *client.Client, fs *flag.FlagSet, args []string) (any, error) {
+			input, err := readInput(fs)
+			if err != nil {
+				return nil, err
+			}
+			var body []byte
+			if err := c.Run(ctx, args[0], input, &body); err != nil {
+				return nil, err
+			}
+			return decodeResult(body), nil
+		},
+		header: []string{"RESULT"},
+		rows:   resultRows,
+	},
+	"call": {
+		usage: "call [-input json|@file] <plugin id> <method>",
+		flags: inputFlag,
+		run: func(ctx context.Context, c *client.Client, fs *flag.FlagSet, args []string) (any, error) {
+			input, err := readInput(fs)
+			if err != nil {
+				return nil, err
+			}
+			var body []byte
+			if err := c.Call(ctx, args[0], args[1], input, &body); err != nil {
+				return nil, err
+			}
+			return decodeResult(body), nil
+		},
+		header: []string{"RESULT"},
+		rows:   resultRows,
+	},
+	"unload": {
+		usage: "unload <plugin id>",
+		run: func(ctx context.Context, c *client.Client, fs *flag.FlagSet, args []string) (any, error) {
+			if err := c.Unload(ctx, args[0]); err != nil {
+				return nil, err
+			}
+			return map[string]string{"message": "plugin unloaded"}, nil
+		},
+		header: []string{"MESSAGE"},
+		rows: func(result any) [][]string {
+			return [][]string{{result.(map[string]string)["message"]}}
+		},
+	},
+	"rollback": {
+		usage: "rollback <plugin id>",
+		run: func(ctx context.Context, c *client.Client, fs *flag.FlagSet, args []string) (any, error) {
+			return c.Rollback(ctx, args[0])
+		},
+		header: []string{"ID", "VERSION", "LOADER"},
+		rows: func(result any) [][]string {
+			meta := result.(*goplugify.Meta)
+			return [][]string{{meta.ID, meta.Version, string(meta.Loader)}}
+		},
+	},
+	"components": {
+		usage: "components",
+		run: func(ctx context.Context, c *client.Client, fs *flag.FlagSet, args []string) (any, error) {
+			return c.Components(ctx)
+		},
+		header: []string{"NAME", "PKG PATH"},
+		rows: func(result any) [][]string {
+			var rows [][]string
+			for _, item := range result.(goplugify.PluginComponentItems) {
+				rows = append(rows, []string{item.Name, item.PkgPath})
+			}
+			return rows
+		},
+	},
+	"services": {
+		usage: "services",
+		run: func(ctx context.Context, c *client.Client, fs *flag.FlagSet, args []string) (any, error) {
+			return c.Services(ctx)
+		},
+		header: []string{"NAME", "PLUGINS", "LOADERS"},
+		rows: func(result any) [][]string {
+			var rows [][]string
+			for _, s := range result.([]goplugify.ServiceInfo) {
+				loaders := make([]string, 0, len(s.Loaders))
+				for _, l := range s.Loaders {
+					loaders = append(loaders, string(l))
+				}
+				rows = append(rows, []string{s.Name, strconv.Itoa(s.Plugins), strings.Join(loaders, ",")})
+			}
+			return rows
+		},
+	},
+}
+
+// argCounts is the number of positional arguments the commands require.
+var argCounts = map[string]int{"load": 1, "get": 1, "run": 1, "call": 2, "unload": 1, "rollback": 1}
+
+func usage(w io.Writer, global *flag.FlagSet) {
+	fmt.Fprintln(w, "usage: plugifyctl [flags] <command> [command flags] [args]")
+	fmt.Fprintln(w, "\ncommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(w, "  "+commands[name].usage)
+	}
+	fmt.Fprintln(w, "\nflags:")
+	global.SetOutput(w)
+	global.PrintDefaults()
+}
+
+// outcome is the result of a command on one host and service.
+type outcome struct {
+	Host    string `json:"host"`
+	Service string `json:"service"`
+	Result  any    `json:"result,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	global := flag.NewFlagSet("plugifyctl", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	configFlag := global.String("config", "", "config file, ~/.plugifyctl.json by default")
+	profileFlag := global.String("profile", "", "profile of the config file, its default one when empty")
+	hostsFlag := global.String("host", "", "comma separated base URLs, overriding the hosts of the profile")
+	servicesFlag := global.String("service", "", "comma separated services, overriding the services of the profile")
+	output := global.String("o", "table", "output format, table or json")
+	timeout := global.Duration("timeout", 30*time.Second, "timeout of each request")
+	global.Usage = func() { usage(stderr, global) }
+	if err := global.Parse(args); err != nil {
+		return 2
+	}
+	if global.NArg() == 0 {
+		usage(stderr, global)
+		return 2
+	}
+	name := global.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %s\n", name)
+		usage(stderr, global)
+		return 2
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	if err := fs.Parse(global.Args()[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() < argCounts[name] {
+		fmt.Fprintln(stderr, "usage: plugifyctl "+cmd.usage)
+		return 2
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintln(stderr, "-o must be table or json")
+		return 2
+	}
+
+	profile, err := loadProfile(configPath(*configFlag), *profileFlag)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	hosts, services := profile.Hosts, profile.Services
+	if *hostsFlag != "" {
+		hosts = strings.Split(*hostsFlag, ",")
+	}
+	if *servicesFlag != "" {
+		services = strings.Split(*servicesFlag, ",")
+	}
+	if len(services) == 0 {
+		services = []string{""}
+	}
+	if len(hosts) == 0 {
+		fmt.Fprintln(stderr, "no host, pass -host or set the hosts of a profile")
+		return 2
+	}
+	appID, appSecret := profile.AppID, profile.AppSecret
+	if env := os.Getenv("PLUGIFY_APP_ID"); env != "" {
+		appID = env
+	}
+	if env := os.Getenv("PLUGIFY_APP_SECRET"); env != "" {
+		appSecret = env
+	}
+
+	var outcomes []outcome
+	failed := false
+	for _, host := range hosts {
+		for _, service := range services {
+			c := client.New(strings.TrimRight(host, "/"), appID, appSecret).WithService(service)
+			ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+			result, err := cmd.run(ctx, c, fs, fs.Args())
+			cancel()
+			o := outcome{Host: host, Service: service, Result: result}
+			if o.Service == "" {
+				o.Service = "default"
+			}
+			if err != nil {
+				o.Error = err.Error()
+				failed = true
+			}
+			outcomes = append(outcomes, o)
+		}
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(outcomes)
+	} else {
+		writeTable(stdout, cmd, outcomes)
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func writeTable(w io.Writer, cmd *command, outcomes []outcome) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(append([]string{"HOST", "SERVICE"}, cmd.header...), "\t"))
+	for _, o := range outcomes {
+		if o.Error != "" {
+			fmt.Fprintf(tw, "%s\t%s\terror: %s\n", o.Host, o.Service, o.Error)
+			continue
+		}
+		for _, row := range cmd.rows(o.Result) {
+			fmt.Fprintln(tw, strings.Join(append([]string{o.Host, o.Service}, row...), "\t"))
+		}
+	}
+	tw.Flush()
+}
+
+func loadCommand(ctx context.Context, c *client.Client, fs *flag.FlagSet, args []string) (any, error) {
+	path := args[0]
+	meta := new(goplugify.Meta)
+	if metaPath := fs.Lookup("meta").Value.String(); metaPath != "" {
+		data, err := os.ReadFile(metaPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, meta); err != nil {
+			return nil, fmt.Errorf("invalid meta %s: %v", metaPath, err)
+		}
+	}
+	if id := fs.Lookup("id").Value.String(); id != "" {
+		meta.ID = id
+	}
+	if meta.ID == "" {
+		meta.ID = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if loader := fs.Lookup("loader").Value.String(); loader != "" {
+		meta.Loader = goplugify.LoaderType(loader)
+	}
+	if meta.Loader == "" {
+		meta.Loader = goplugify.LoaderTypeYaegiHTTP
+		if filepath.Ext(path) == ".so" {
+			meta.Loader = goplugify.LoaderTypeNativePluginHTTP
+		}
+	}
+
+	assetsPath := fs.Lookup("assets").Value.String()
+	if assetsPath == "" {
+		return c.LoadFile(ctx, meta, path)
+	}
+	artifact, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	assets, err := os.ReadFile(assetsPath)
+	if err != nil {
+		return nil, err
+	}
+	return c.LoadBundle(ctx, meta, artifact, assets)
+}
+
+func listCommand(ctx context.Context, c *client.Client, fs *flag.FlagSet, args []string) (any, error) {
+	value := func(name string) string { return fs.Lookup(name).Value.String() }
+	limit, _ := strconv.Atoi(value("limit"))
+	return c.List(ctx, goplugify.ListOptions{
+		Loader: goplugify.LoaderType(value("loader")),
+		Author: value("author"),
+		State:  goplugify.PluginState(value("state")),
+		Tag:    value("tag"),
+		Prefix: value("prefix"),
+		Sort:   value("sort"),
+		Desc:   value("desc") == "true",
+		Cursor: value("cursor"),
+		Limit:  limit,
+	})
+}
+
+func inputFlag(fs *flag.FlagSet) {
+	fs.String("input", "", "JSON input, or @file to read it from a file")
+}
+
+// readInput decodes the -input flag, nil when it is empty.
+func readInput(fs *flag.FlagSet) (any, error) {
+	raw := fs.Lookup("input").Value.String()
+	if strings.HasPrefix(raw, "@") {
+		data, err := os.ReadFile(raw[1:])
+		if err != nil {
+			return nil, err
+		}
+		raw = string(data)
+	}
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var input any
+	if err := json.Unmarshal([]byte(raw), &input); err != nil {
+		return nil, fmt.Errorf("invalid input: %v", err)
+	}
+	return input, nil
+}
+
+// decodeResult decodes a JSON result, other bodies are kept as text.
+func decodeResult(body []byte) any {
+	var result any
+	if err := json.Unmarshal(body, &result); err != nil {
+		return string(body)
+	}
+	return result
+}
+
+func resultRows(result any) [][]string {
+	if s, ok := result.(string); ok {
+		return [][]string{{s}}
+	}
+	data, _ := json.Marshal(result)
+	return [][]string{{string(data)}}
+}
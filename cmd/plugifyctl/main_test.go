@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	goplugify "github.com/go-plugify/go-plugify"
+)
+
+const testScript = `package main
+
+func Run(input map[string]any) (any, error) {
+	return map[string]any{"echo": input["body"]}, nil
+}
+
+func Methods() map[string]func(any) any {
+	return map[string]func(any) any{
+		"ping": func(input any) any { return "pong" },
+	}
+}
+
+func Destroy(input map[string]any) error {
+	return nil
+}
+`
+
+func newTestHost(t *testing.T) string {
+	t.Helper()
+	server := goplugify.InitHTTPServer(goplugify.InitPluginManagers("default"))
+	server.SetStatusCodes(true)
+	server.Registry().Add("billing", goplugify.NewPluginManager("billing"))
+	mux := goplugify.NewServeMuxRouter(nil)
+	router := goplugify.WithAuthHttpRouter(mux, goplugify.NewHMACAuth("ops", "secret"))
+	server.RegisterRoutes(router, "/api")
+	server.RegisterRoutesV2(router, "/api/v2")
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts.URL + "/api"
+}
+
+func TestPlugifyctl(t *testing.T) {
+	hosts := []string{newTestHost(t), newTestHost(t)}
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.json")
+	data, _ := json.Marshal(Config{Default: "test", Profiles: map[string]*Profile{
+		"test": {Hosts: hosts, AppID: "ops", AppSecret: "secret", Services: []string{"default", "billing"}},
+	}})
+	os.WriteFile(config, data, 0o600)
+	script := filepath.Join(dir, "echo.go")
+	os.WriteFile(script, []byte(testScript), 0o644)
+
+	ctl := func(args ...string) (string, int) {
+		var stdout, stderr bytes.Buffer
+		code := run(append([]string{"-config", config}, args...), &stdout, &stderr)
+		return stdout.String() + stderr.String(), code
+	}
+
+	out, code := ctl("load", script)
+	if code != 0 || strings.Count(out, "echo") != 4 {
+		t.Fatalf("expected the plugin to be loaded on every host and service, got %d:\n%s", code, out)
+	}
+
+	out, code = ctl("-o", "json", "-service", "billing", "run", "-input", `{"n": 1}`, "echo")
+	var outcomes []outcome
+	if err := json.Unmarshal([]byte(out), &outcomes); err != nil || code != 0 || len(outcomes) != 2 {
+		t.Fatalf("unexpected run output %d: %s", code, out)
+	}
+	if result, _ := outcomes[1].Result.(map[string]any); outcomes[1].Service != "billing" || result["echo"].(map[string]any)["n"] != float64(1) {
+		t.Errorf("unexpected run outcome %+v", outcomes[1])
+	}
+
+	out, code = ctl("-host", hosts[0], "call", "echo", "ping")
+	if code != 0 || strings.Count(out, "pong") != 2 {
+		t.Errorf("unexpected call output %d:\n%s", code, out)
+	}
+
+	out, code = ctl("-host", hosts[0], "list", "-prefix", "ec")
+	if code != 0 || !strings.Contains(out, "LAST RUN") || strings.Count(out, "echo") != 2 {
+		t.Errorf("unexpected list output %d:\n%s", code, out)
+	}
+
+	out, code = ctl("-host", hosts[0], "-service", "default", "rollback", "echo")
+	if code != 1 || !strings.Contains(out, "no previous version") {
+		t.Errorf("expected a failed rollback, got %d:\n%s", code, out)
+	}
+
+	out, code = ctl("-host", hosts[1], "-service", "billing", "unload", "echo")
+	if code != 0 || !strings.Contains(out, "plugin unloaded") {
+		t.Errorf("unexpected unload output %d:\n%s", code, out)
+	}
+	out, code = ctl("-host", hosts[1], "-service", "billing", "get", "echo")
+	if code != 1 || !strings.Contains(out, "not_found") {
+		t.Errorf("expected the plugin to be gone, got %d:\n%s", code, out)
+	}
+
+	out, code = ctl("services")
+	if code != 0 || strings.Count(out, "yaegi_http") != 8 {
+		t.Errorf("unexpected services output %d:\n%s", code, out)
+	}
+
+	if _, code := ctl("call", "echo"); code != 2 {
+		t.Errorf("expected a usage error, got %d", code)
+	}
+	if _, code := ctl("-profile", "missing", "components"); code != 1 {
+		t.Errorf("expected an unknown profile to fail, got %d", code)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Profile holds the hosts of an environment and the credentials to sign requests
+// with. Hosts are base URLs including the route prefix, such as
+// http://10.0.0.1:8080/api.
+type Profile struct {
+	Hosts     []string `json:"hosts"`
+	AppID     string   `json:"app_id"`
+	AppSecret string   `json:"app_secret"`
+	// Services defaults to the default service of each host.
+	Services []string `json:"services,omitempty"`
+}
+
+// Config is the credentials file, ~/.plugifyctl.json unless -config or
+// PLUGIFYCTL_CONFIG name another one.
+type Config struct {
+	// Default names the profile used without -profile.
+	Default  string              `json:"default"`
+	Profiles map[string]*Profile `json:"profiles"`
+}
+
+func configPath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if env := os.Getenv("PLUGIFYCTL_CONFIG"); env != "" {
+		return env
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".plugifyctl.json"
+	}
+	return filepath.Join(home, ".plugifyctl.json")
+}
+
+// loadProfile reads the profile name of the config at path. A missing config is
+// not an error as long as hosts and credentials come from flags or the environment.
+func loadProfile(path, name string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && name == "" {
+		return &Profile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+	if name == "" {
+		name = config.Default
+	}
+	if name == "" {
+		return &Profile{}, nil
+	}
+	profile, ok := config.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %s not found in %s", name, path)
+	}
+	return profile, nil
+}
@@ -0,0 +1,47 @@
+package goplugify
+
+import (
+	_ "embed"
+	"html"
+	"strings"
+)
+
+//go:embed console/index.html
+var consoleHTML string
+
+// ConsoleOptions tells the console where the management routes are mounted.
+type ConsoleOptions struct {
+	// APIPrefix is the prefix RegisterRoutes was called with.
+	APIPrefix string
+	// V2Prefix is the prefix RegisterRoutesV2 was called with, method calls are
+	// disabled in the console when it is empty.
+	V2Prefix string
+	// UIPrefix is the prefix RegisterPluginUI was called with, plugins with assets
+	// are linked to their pages when it is set.
+	UIPrefix string
+}
+
+// RegisterConsole serves the web management console at {routePrefix}/console. The
+// page holds no secret, so router is usually not authenticated: the console signs
+// each API call with the app ID and secret entered by the user, and the routes it
+// calls are checked by the Authenticator they were registered with. The router must
+// provide contexts implementing HttpStreamContext.
+func (server *HTTPServer) RegisterConsole(router HttpRouter, routePrefix string, opts ConsoleOptions) {
+	page := strings.NewReplacer(
+		"{{API_PREFIX}}", html.EscapeString(opts.APIPrefix),
+		"{{API_V2_PREFIX}}", html.EscapeString(opts.V2Prefix),
+		"{{UI_PREFIX}}", html.EscapeString(opts.UIPrefix),
+	).Replace(consoleHTML)
+
+	router.Add("GET", routePrefix+"/console", func(c HttpContext) {
+		sc, ok := c.(HttpStreamContext)
+		if !ok {
+			ErrorRet(c, NewCodeError(CodeInvalidRequest, "serving the console is not supported by the http router"))
+			return
+		}
+		sc.SetHeader("Content-Type", "text/html; charset=utf-8")
+		sc.SetHeader("Cache-Control", "no-cache")
+		sc.WriteHeader(200)
+		sc.Write([]byte(page))
+	})
+}
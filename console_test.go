@@ -0,0 +1,110 @@
+package goplugify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestConsole(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	router := NewServeMuxRouter(nil)
+	server.RegisterConsole(router, "/admin", ConsoleOptions{APIPrefix: "/api", V2Prefix: "/api/v2"})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/admin/console")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("unexpected console response %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(string(page), `content="/api"`) || !strings.Contains(string(page), `content="/api/v2"`) {
+		t.Error("expected the API prefixes in the console page")
+	}
+}
+
+func TestRollback(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	putTestPlugin(t, server, "demo", LoaderTypeYaegiHTTP)
+
+	c := newStatusTestContext()
+	c.query["plugin_id"] = "demo"
+	server.Rollback(c)
+	if c.status != 409 {
+		t.Fatalf("expected 409 without a previous version, got %d: %v", c.status, c.resp)
+	}
+
+	c = newTestContext()
+	c.params["id"] = "demo"
+	c.form["meta"] = `{"loader": "yaegi_http", "version": "v2"}`
+	c.body = []byte(strings.Replace(testScript, `"ran"`, `"ran v2"`, 1))
+	server.putPluginV2(c)
+
+	c = newTestContext()
+	c.query["plugin_id"] = "demo"
+	server.Rollback(c)
+	if c.status != 200 {
+		t.Fatalf("rollback: %d %v", c.status, c.resp)
+	}
+	plugin, _ := server.Registry().managers["default"].GetPlugin("demo")
+	if resp, _ := plugin.OnRun(nil); resp != "ran" || plugin.Meta().Version != "" {
+		t.Errorf("expected the first version back, got %v %q", resp, plugin.Meta().Version)
+	}
+
+	server.Rollback(c)
+	if resp, _ := plugin.OnRun(nil); resp != "ran v2" || plugin.Meta().Version != "v2" {
+		t.Errorf("expected a second rollback to restore v2, got %v %q", resp, plugin.Meta().Version)
+	}
+}
+
+// TestConsoleCanonicalString runs the signer of the console with node, when it is
+// installed, and checks that it builds the canonical string HMACAuth verifies.
+func TestConsoleCanonicalString(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node is not installed")
+	}
+	begin := strings.Index(consoleHTML, "// canonical:begin")
+	end := strings.Index(consoleHTML, "// canonical:end")
+	if begin < 0 || end < begin {
+		t.Fatal("canonical string functions not found in the console")
+	}
+
+	urls := []string{
+		"/api/plugin/list?service=default",
+		"/api/plugin/run?service=d%26e&plugin_id=%C3%A9t%C3%A9",
+		"/api/v2/plugins/a%20b/methods/run!?b=2&a=1&a=0&c=x+y&d=%2B",
+		"/api/v2/plugins/a%2Fb/methods/%24x:y@z?q=(1)*'~",
+		"/api/plugin/services",
+	}
+	credentials := "appid=console&nonce=n&timestamp=1"
+	script := consoleHTML[begin:end] + `
+const urls = JSON.parse(process.argv[1]);
+console.log(JSON.stringify(urls.map((u) => canonicalString('post', new URL(u, 'http://localhost'), '` + credentials + `'))));
+`
+	input, _ := json.Marshal(urls)
+	out, err := exec.Command(node, "-e", script, string(input)).Output()
+	if err != nil {
+		t.Fatalf("node: %v", err)
+	}
+	var got []string
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("node output %q: %v", out, err)
+	}
+	for i, raw := range urls {
+		u, _ := url.Parse(raw)
+		params := HMACAuthSignParams{AppID: "console", Nonce: "n", Timestamp: "1", Version: SignVersion2, Method: "POST", Path: u.Path, Query: u.RawQuery}
+		if want := params.buildCanonicalString(); got[i] != want {
+			t.Errorf("%s: console signs %q, expected %q", raw, got[i], want)
+		}
+	}
+}
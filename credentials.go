@@ -0,0 +1,176 @@
+package goplugify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// AppIDKey is the context key of the app ID authenticated by HMACAuth, see AppIDOf.
+	AppIDKey = "go-plugify.app_id"
+	// ContentHashKey is the context key of the signed content hash, see ContentHashOf.
+	ContentHashKey = "go-plugify.content_hash"
+	// MetaHashKey and AssetsHashKey are the context keys of the signed hashes of the
+	// meta and assets form fields of an upload.
+	MetaHashKey   = "go-plugify.meta_hash"
+	AssetsHashKey = "go-plugify.assets_hash"
+)
+
+// HttpValueContext is implemented by contexts that can carry values set by the
+// middlewares, such as the authenticated app ID. gin.Context implements it.
+type HttpValueContext interface {
+	Set(key string, value any)
+}
+
+// AppIDOf returns the app ID HMACAuth authenticated the request of ctx with, empty
+// when the request was not authenticated or its context cannot carry values.
+func AppIDOf(ctx context.Context) string {
+	appID, _ := ctx.Value(AppIDKey).(string)
+	return appID
+}
+
+// ContentHashOf returns the hex SHA-256 HMACAuth verified the signature of the
+// request of ctx with, empty when the request carried none. The artifact uploaded
+// with the request is rejected when its hash differs.
+func ContentHashOf(ctx context.Context) string {
+	return signedHash(ctx, ContentHashKey)
+}
+
+// signedHashHeaders are the headers of the signed hashes, read when the context of
+// the request could not carry them.
+var signedHashHeaders = map[string]string{
+	ContentHashKey: "X-Go-Plugify-Content-Hash",
+	MetaHashKey:    "X-Go-Plugify-Meta-Hash",
+	AssetsHashKey:  "X-Go-Plugify-Assets-Hash",
+}
+
+// signedHash falls back to the header of key when ctx carries no value for it, as
+// the contexts without HttpValueContext do. Behind HMACAuth the signature covers the
+// header, elsewhere an unsigned header only makes the upload checked against it.
+func signedHash(ctx context.Context, key string) string {
+	value := ctx.Value(key)
+	if c, ok := ctx.(HttpContext); ok && value == nil {
+		return c.GetHeader(signedHashHeaders[key])
+	}
+	hash, _ := value.(string)
+	return hash
+}
+
+// Secret is one of the secrets of an app, several are active while a secret is
+// being rotated.
+type Secret struct {
+	Secret string `json:"secret"`
+	// ExpiresAt is the time from which the secret is rejected, never when nil.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Credential is the authentication data of an app calling the management API.
+type Credential struct {
+	AppID    string   `json:"app_id"`
+	Secrets  []Secret `json:"secrets"`
+	Disabled bool     `json:"disabled,omitempty"`
+}
+
+// activeSecrets returns the secrets of c that have not expired at now.
+func (c *Credential) activeSecrets(now time.Time) []string {
+	var secrets []string
+	for _, s := range c.Secrets {
+		if s.ExpiresAt == nil || now.Before(*s.ExpiresAt) {
+			secrets = append(secrets, s.Secret)
+		}
+	}
+	return secrets
+}
+
+// CredentialProvider looks up the credential of an app, nil when the app is unknown.
+type CredentialProvider interface {
+	Credential(ctx context.Context, appID string) (*Credential, error)
+}
+
+// StaticCredentials is a CredentialProvider over a fixed set of credentials.
+type StaticCredentials map[string]*Credential
+
+func NewStaticCredentials(credentials ...*Credential) StaticCredentials {
+	s := make(StaticCredentials)
+	for _, c := range credentials {
+		s[c.AppID] = c
+	}
+	return s
+}
+
+func (s StaticCredentials) Credential(ctx context.Context, appID string) (*Credential, error) {
+	return s[appID], nil
+}
+
+// DefaultCredentialsReloadInterval is how often FileCredentials checks its file.
+var DefaultCredentialsReloadInterval = 5 * time.Second
+
+// FileCredentials reads the credentials from a JSON file, {"apps": [Credential...]},
+// and reloads it when its modification time changes. A file that fails to parse is
+// logged and the credentials read before stay in use.
+type FileCredentials struct {
+	path string
+	// ReloadInterval is the minimum time between two checks of the file.
+	ReloadInterval time.Duration
+	// Logger reports the reloads that fail, the previous credentials are kept.
+	Logger Logger
+
+	credentials StaticCredentials
+	modTime     time.Time
+	checkedAt   time.Time
+	lock        sync.Mutex
+}
+
+func NewFileCredentials(path string) (*FileCredentials, error) {
+	f := &FileCredentials{path: path, ReloadInterval: DefaultCredentialsReloadInterval, Logger: &DefaultLogger{}}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload reads the file if it changed since the last read.
+func (f *FileCredentials) Reload() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.reload()
+}
+
+func (f *FileCredentials) reload() error {
+	f.checkedAt = time.Now()
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	if f.credentials != nil && info.ModTime().Equal(f.modTime) {
+		return nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	var file struct {
+		Apps []*Credential `json:"apps"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid credentials file %s: %v", f.path, err)
+	}
+	f.credentials = NewStaticCredentials(file.Apps...)
+	f.modTime = info.ModTime()
+	return nil
+}
+
+func (f *FileCredentials) Credential(ctx context.Context, appID string) (*Credential, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if time.Since(f.checkedAt) >= f.ReloadInterval {
+		if err := f.reload(); err != nil && f.Logger != nil {
+			f.Logger.Error("reload credentials: %v", err)
+		}
+	}
+	return f.credentials[appID], nil
+}
@@ -0,0 +1,90 @@
+package goplugify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHMACAuthCredentials(t *testing.T) {
+	expired := time.Now().Add(-time.Hour)
+	auth := NewCredentialsHMACAuth(NewStaticCredentials(
+		&Credential{AppID: "ops", Secrets: []Secret{{Secret: "old", ExpiresAt: &expired}, {Secret: "current"}, {Secret: "next"}}},
+		&Credential{AppID: "billing", Secrets: []Secret{{Secret: "s"}}, Disabled: true},
+	))
+	now := time.Now()
+
+	for i, secret := range []string{"current", "next"} {
+		if err := auth.Auth(signedTestContext("ops", secret, "n"+secret, now)); err != nil {
+			t.Errorf("expected active secret %d to pass: %v", i, err)
+		}
+	}
+	if err := auth.Auth(signedTestContext("ops", "old", "n1", now)); err == nil {
+		t.Error("expected an expired secret to be rejected")
+	}
+	if err := auth.Auth(signedTestContext("billing", "s", "n2", now)); err == nil || !strings.Contains(err.Error(), "disabled") {
+		t.Errorf("expected a disabled app to be rejected, got %v", err)
+	}
+	if err := auth.Auth(signedTestContext("nobody", "s", "n3", now)); err == nil || !strings.Contains(err.Error(), "appid") {
+		t.Errorf("expected an unknown app to be rejected, got %v", err)
+	}
+}
+
+func TestFileCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	write := func(content string, modTime time.Time) {
+		os.WriteFile(path, []byte(content), 0o600)
+		os.Chtimes(path, modTime, modTime)
+	}
+	write(`{"apps": [{"app_id": "ops", "secrets": [{"secret": "a"}]}]}`, time.Now().Add(-time.Minute))
+	credentials, err := NewFileCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentials.ReloadInterval = 0
+	auth := NewCredentialsHMACAuth(credentials)
+
+	if err := auth.Auth(signedTestContext("ops", "a", "n1", time.Now())); err != nil {
+		t.Fatalf("expected the file secret to pass: %v", err)
+	}
+
+	write(`{"apps": [{"app_id": "ops", "secrets": [{"secret": "b"}]}]}`, time.Now())
+	if err := auth.Auth(signedTestContext("ops", "b", "n2", time.Now())); err != nil {
+		t.Errorf("expected the rotated secret to pass after a reload: %v", err)
+	}
+	if err := auth.Auth(signedTestContext("ops", "a", "n3", time.Now())); err == nil {
+		t.Error("expected the removed secret to be rejected")
+	}
+
+	write(`{"apps": [`, time.Now().Add(time.Minute))
+	if err := auth.Auth(signedTestContext("ops", "b", "n4", time.Now())); err != nil {
+		t.Errorf("expected a broken file to keep the previous credentials: %v", err)
+	}
+
+	if _, err := NewFileCredentials(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected a missing file to fail")
+	}
+}
+
+func TestAppIDOnContext(t *testing.T) {
+	var caller string
+	mux := NewServeMuxRouter(nil)
+	auth := NewCredentialsHMACAuth(NewStaticCredentials(&Credential{AppID: "ops", Secrets: []Secret{{Secret: "s"}}}))
+	WithAuthHttpRouter(mux, auth).Add(http.MethodGet, "/whoami", func(c HttpContext) {
+		caller = AppIDOf(c)
+	})
+
+	signed := signedTestContext("ops", "s", "n1", time.Now())
+	req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	for key, value := range signed.headers {
+		req.Header.Set(key, value)
+	}
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	if caller != "ops" {
+		t.Errorf("expected the authenticated app on the context, got %q", caller)
+	}
+}
@@ -1,19 +1,181 @@
 package goplugify
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrorCode classifies a PlugifyError so that callers can react to it programmatically.
+type ErrorCode string
+
+const (
+	CodeUnknown        ErrorCode = "unknown"
+	CodeInvalidRequest ErrorCode = "invalid_request"
+	CodeInvalidMeta    ErrorCode = "invalid_meta"
+	CodeInvalidSource  ErrorCode = "invalid_source"
+	CodeInvalidPlugin  ErrorCode = "invalid_plugin"
+	CodeNotFound       ErrorCode = "not_found"
+	CodeLoaderNotFound ErrorCode = "loader_not_found"
+	CodeLoadFailed     ErrorCode = "load_failed"
+	CodeInitFailed     ErrorCode = "init_failed"
+	CodeRunFailed      ErrorCode = "run_failed"
+	CodeInvalidOutput  ErrorCode = "invalid_output"
+	CodeDestroyFailed  ErrorCode = "destroy_failed"
+	CodeTimeout        ErrorCode = "timeout"
+	CodeCanceled       ErrorCode = "canceled"
+	CodeUnauthorized   ErrorCode = "unauthorized"
+	CodeForbidden      ErrorCode = "forbidden"
+	CodeConflict       ErrorCode = "conflict"
+	CodeTooLarge       ErrorCode = "too_large"
+	CodeUnavailable    ErrorCode = "unavailable"
+)
+
+// HTTPStatus returns the status code the HTTP server answers with for c.
+func (c ErrorCode) HTTPStatus() int {
+	switch c {
+	case CodeInvalidRequest, CodeInvalidMeta, CodeInvalidSource, CodeInvalidPlugin, CodeLoaderNotFound:
+		return 400
+	case CodeUnauthorized:
+		return 401
+	case CodeForbidden:
+		return 403
+	case CodeNotFound:
+		return 404
+	case CodeConflict:
+		return 409
+	case CodeTooLarge:
+		return 413
+	case CodeCanceled:
+		return 499
+	case CodeUnavailable:
+		return 503
+	case CodeTimeout:
+		return 504
+	}
+	return 500
+}
+
 var (
-	ErrInvalidLoaderSource = NewError("invalid loader source")
-	ErrPluginNoLoadMethod  = NewError("plugin has no load method")
-	ErrPluginNoRunMethod   = NewError("plugin has no run method")
+	ErrInvalidLoaderSource = NewCodeError(CodeInvalidSource, "invalid loader source")
+	ErrInvalidMeta         = NewCodeError(CodeInvalidMeta, "invalid meta")
+	ErrPluginNoLoadMethod  = NewCodeError(CodeInvalidPlugin, "plugin has no load method")
+	ErrPluginNoRunMethod   = NewCodeError(CodeInvalidPlugin, "plugin has no run method")
+	ErrArtifactTooLarge    = NewCodeError(CodeTooLarge, "plugin artifact too large")
+	ErrBodyTooLarge        = NewCodeError(CodeTooLarge, "request body too large")
+	ErrPluginNotFound      = NewCodeError(CodeNotFound, "plugin not found")
+	ErrLoaderNotFound      = NewCodeError(CodeLoaderNotFound, "loader not found")
+	ErrUnauthorized        = NewCodeError(CodeUnauthorized, "authentication failed")
+	ErrForbidden           = NewCodeError(CodeForbidden, "permission denied")
+	ErrContentHashMismatch = NewCodeError(CodeUnauthorized, "content does not match the signed content hash")
+	ErrNoPreviousVersion   = NewCodeError(CodeConflict, "plugin has no previous version")
 )
 
 func NewError(message string) error {
-	return &PlugifyError{message: message}
+	return &PlugifyError{Code: CodeUnknown, message: message}
+}
+
+func NewCodeError(code ErrorCode, message string) *PlugifyError {
+	return &PlugifyError{Code: code, message: message}
+}
+
+// WrapError attaches the operation and plugin ID to err. The code of err is kept when
+// it already carries one, code is used otherwise.
+func WrapError(code ErrorCode, op, pluginID string, err error) error {
+	if inner := CodeOf(err); inner != CodeUnknown {
+		code = inner
+	}
+	return &PlugifyError{
+		Code:     code,
+		Op:       op,
+		PluginID: pluginID,
+		Err:      err,
+	}
+}
+
+// prefixError prefixes err with the message of the original routes, unless err
+// already names its operation.
+func prefixError(prefix string, err error) error {
+	var pe *PlugifyError
+	if errors.As(err, &pe) && pe.Op != "" {
+		return err
+	}
+	return fmt.Errorf("%s: %w", prefix, err)
 }
 
+// PlugifyError is the error type returned by the manager, the loaders and the HTTP server.
 type PlugifyError struct {
+	Code     ErrorCode
+	Op       string
+	PluginID string
+	// Details holds structured information for clients, such as validation violations.
+	Details any
+	Err     error
+
 	message string
 }
 
 func (e *PlugifyError) Error() string {
-	return e.message
+	var sb strings.Builder
+	if e.Op != "" {
+		sb.WriteString(e.Op)
+	}
+	if e.PluginID != "" {
+		if sb.Len() > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString("plugin " + e.PluginID)
+	}
+	if sb.Len() > 0 && (e.message != "" || e.Err != nil) {
+		sb.WriteString(": ")
+	}
+	sb.WriteString(e.message)
+	if e.Err != nil {
+		if e.message != "" {
+			sb.WriteString(": ")
+		}
+		sb.WriteString(e.Err.Error())
+	}
+	return sb.String()
+}
+
+func (e *PlugifyError) Unwrap() error {
+	return e.Err
+}
+
+// CodeOf returns the code of the outermost PlugifyError in the chain of err that has one.
+func CodeOf(err error) ErrorCode {
+	for err != nil {
+		var pe *PlugifyError
+		if !errors.As(err, &pe) {
+			break
+		}
+		if pe.Code != "" && pe.Code != CodeUnknown {
+			return pe.Code
+		}
+		err = pe.Err
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled
+	}
+	return CodeUnknown
+}
+
+// DetailsOf returns the details of the first PlugifyError in the chain of err that has any.
+func DetailsOf(err error) any {
+	for err != nil {
+		var pe *PlugifyError
+		if !errors.As(err, &pe) {
+			return nil
+		}
+		if pe.Details != nil {
+			return pe.Details
+		}
+		err = pe.Err
+	}
+	return nil
 }
@@ -0,0 +1,98 @@
+package goplugify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorTaxonomy(t *testing.T) {
+	manager := InitPluginManagers("default")["default"]
+
+	_, err := manager.GetPlugin("demo")
+	var pe *PlugifyError
+	if !errors.As(err, &pe) || pe.Code != CodeNotFound || pe.Op != "get" || pe.PluginID != "demo" {
+		t.Fatalf("unexpected error %#v", err)
+	}
+	if !errors.Is(err, ErrPluginNotFound) {
+		t.Errorf("expected %v to wrap ErrPluginNotFound", err)
+	}
+	if err.Error() != "get plugin demo: plugin not found" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+
+	_, err = manager.LoadPlugin(context.Background(), &Meta{ID: "demo", Loader: "nope"}, nil)
+	if CodeOf(err) != CodeLoaderNotFound || !errors.Is(err, ErrLoaderNotFound) {
+		t.Errorf("expected loader not found, got %v", err)
+	}
+
+	_, err = manager.LoadPlugin(context.Background(), &Meta{ID: "demo", Loader: LoaderTypeYaegiHTTP}, "not a context")
+	if CodeOf(err) != CodeInvalidSource || !errors.Is(err, ErrInvalidLoaderSource) {
+		t.Errorf("expected invalid source, got %v", err)
+	}
+
+	_, err = manager.LoadPlugin(context.Background(), &Meta{ID: "demo"}, nil)
+	if CodeOf(err) != CodeInvalidMeta || CodeOf(err).HTTPStatus() != 400 {
+		t.Errorf("expected invalid meta, got %v", err)
+	}
+}
+
+func TestCodeOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		code ErrorCode
+	}{
+		{errors.New("boom"), CodeUnknown},
+		{NewError("boom"), CodeUnknown},
+		{fmt.Errorf("outer: %w", ErrArtifactTooLarge), CodeTooLarge},
+		{WrapError(CodeLoadFailed, "load", "demo", ErrArtifactTooLarge), CodeTooLarge},
+		{WrapError(CodeRunFailed, "run", "demo", errors.New("boom")), CodeRunFailed},
+		{WrapError(CodeRunFailed, "run", "demo", context.DeadlineExceeded), CodeTimeout},
+		{fmt.Errorf("run: %w", context.DeadlineExceeded), CodeTimeout},
+	}
+	for _, tt := range tests {
+		if code := CodeOf(tt.err); code != tt.code {
+			t.Errorf("CodeOf(%v) = %s, want %s", tt.err, code, tt.code)
+		}
+	}
+}
+
+func TestPrefixError(t *testing.T) {
+	wrapped := WrapError(CodeRunFailed, "run", "demo", errors.New("boom"))
+	if err := prefixError("run plugin error", wrapped); err.Error() != "run plugin demo: boom" {
+		t.Errorf("expected the operation not to be repeated, got %q", err)
+	}
+	if err := prefixError("load plugin error", fmt.Errorf("change 0: %w", wrapped)); err.Error() != "change 0: run plugin demo: boom" {
+		t.Errorf("expected a wrapped operation not to be prefixed, got %q", err)
+	}
+	if err := prefixError("load plugin error", ErrArtifactTooLarge); !errors.Is(err, ErrArtifactTooLarge) || err.Error() != "load plugin error: "+ErrArtifactTooLarge.Error() {
+		t.Errorf("expected the prefix on an error without operation, got %q", err)
+	}
+}
+
+func TestErrorRet(t *testing.T) {
+	violation := &PlugifyError{Code: CodeInvalidRequest, message: "invalid input", Details: []SchemaViolation{{Path: "id", Message: "is required"}}}
+	tests := []struct {
+		err         error
+		want        int
+		statusCodes int
+	}{
+		{ErrPluginNotFound, 500, 404},
+		{fmt.Errorf("%w: body exceeds 10 bytes", ErrArtifactTooLarge), 413, 413},
+		{WrapError(CodeInvalidRequest, "run", "demo", violation), 400, 400},
+		{NewCodeError(CodeInvalidRequest, "invalid limit"), 500, 400},
+	}
+	for _, tt := range tests {
+		c := newTestContext()
+		ErrorRet(c, tt.err)
+		if c.status != tt.want {
+			t.Errorf("%v: expected %d by default, got %d", tt.err, tt.want, c.status)
+		}
+		c = newStatusTestContext()
+		ErrorRet(c, tt.err)
+		if c.status != tt.statusCodes {
+			t.Errorf("%v: expected %d with status codes, got %d", tt.err, tt.statusCodes, c.status)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package goplugify
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// AnyMethod matches every HTTP method in a gateway route.
+const AnyMethod = "*"
+
+// GatewayMethods are the methods routed to the gateway when it is mounted on a prefix.
+var GatewayMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+var ErrRouteConflict = NewCodeError(CodeConflict, "route conflict")
+
+type segmentKind int
+
+const (
+	segmentStatic segmentKind = iota
+	segmentParam
+	segmentWildcard
+)
+
+type routeSegment struct {
+	kind  segmentKind
+	value string
+}
+
+// gatewayRoute is a handler added by a plugin. Patterns are made of static segments,
+// "{name}" parameters and an optional trailing "*" or "{name...}" wildcard.
+type gatewayRoute struct {
+	method   string
+	pattern  string
+	segments []routeSegment
+	handler  Handler
+	// literal routes, added by AddHandler, match their pattern as is.
+	literal bool
+}
+
+// GatewayRoute describes a route added to the gateway.
+type GatewayRoute struct {
+	Method  string `json:"method"`
+	Pattern string `json:"pattern"`
+}
+
+func parseRoutePattern(pattern string) ([]routeSegment, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("pattern %s must start with /", pattern)
+	}
+	parts := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	segments := make([]routeSegment, 0, len(parts))
+	for i, part := range parts {
+		last := i == len(parts)-1
+		switch {
+		case part == "*":
+			if !last {
+				return nil, fmt.Errorf("pattern %s: wildcard must be the last segment", pattern)
+			}
+			segments = append(segments, routeSegment{kind: segmentWildcard, value: "*"})
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "...}"):
+			if !last {
+				return nil, fmt.Errorf("pattern %s: wildcard must be the last segment", pattern)
+			}
+			segments = append(segments, routeSegment{kind: segmentWildcard, value: part[1 : len(part)-4]})
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+			name := part[1 : len(part)-1]
+			if name == "" {
+				return nil, fmt.Errorf("pattern %s: empty parameter name", pattern)
+			}
+			segments = append(segments, routeSegment{kind: segmentParam, value: name})
+		default:
+			segments = append(segments, routeSegment{kind: segmentStatic, value: part})
+		}
+	}
+	return segments, nil
+}
+
+// shape identifies the paths a pattern matches regardless of its parameter names.
+func (r *gatewayRoute) shape() string {
+	var sb strings.Builder
+	for _, seg := range r.segments {
+		sb.WriteString("/")
+		switch seg.kind {
+		case segmentStatic:
+			sb.WriteString(seg.value)
+		case segmentParam:
+			sb.WriteString("{}")
+		case segmentWildcard:
+			sb.WriteString("*")
+		}
+	}
+	return sb.String()
+}
+
+func (r *gatewayRoute) match(method string, parts []string) (map[string]string, bool) {
+	if r.method != AnyMethod && method != AnyMethod && r.method != method {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, seg := range r.segments {
+		if seg.kind == segmentWildcard {
+			params[seg.value] = strings.Join(parts[i:], "/")
+			return params, true
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+		switch seg.kind {
+		case segmentStatic:
+			if parts[i] != seg.value {
+				return nil, false
+			}
+		case segmentParam:
+			if parts[i] == "" {
+				return nil, false
+			}
+			params[seg.value] = parts[i]
+		}
+	}
+	return params, len(parts) == len(r.segments)
+}
+
+// moreSpecific reports whether r takes precedence over other: static segments beat
+// parameters which beat wildcards, longer patterns win, then explicit methods.
+func (r *gatewayRoute) moreSpecific(other *gatewayRoute) bool {
+	for i := 0; i < len(r.segments) && i < len(other.segments); i++ {
+		if r.segments[i].kind != other.segments[i].kind {
+			return r.segments[i].kind < other.segments[i].kind
+		}
+	}
+	if len(r.segments) > len(other.segments) {
+		return r.segments[len(other.segments)].kind != segmentWildcard
+	}
+	if len(r.segments) < len(other.segments) {
+		return other.segments[len(r.segments)].kind == segmentWildcard
+	}
+	return r.method != AnyMethod && other.method == AnyMethod
+}
+
+// AddRoute adds a gateway route for method, or AnyMethod, and pattern. Adding the same
+// pattern again replaces its handler, a pattern matching the same paths under other
+// parameter names is a conflict.
+func (server *HTTPServer) AddRoute(method, pattern string, handler Handler) error {
+	method = strings.ToUpper(method)
+	if method == "" {
+		method = AnyMethod
+	}
+	segments, err := parseRoutePattern(pattern)
+	if err != nil {
+		return WrapError(CodeInvalidRequest, "add route", "", err)
+	}
+	route := &gatewayRoute{
+		method:   method,
+		pattern:  pattern,
+		segments: segments,
+		handler:  handler,
+	}
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	for i, exist := range server.gatewayRoutes {
+		if exist.literal || exist.method != method || exist.shape() != route.shape() {
+			continue
+		}
+		if exist.pattern != pattern {
+			return fmt.Errorf("%w: %s %s overlaps %s", ErrRouteConflict, method, pattern, exist.pattern)
+		}
+		server.gatewayRoutes[i] = route
+		return nil
+	}
+	server.gatewayRoutes = append(server.gatewayRoutes, route)
+	return nil
+}
+
+// AddHandler adds a handler for every method on path taken literally, the way the
+// original gateway matched the path query parameter. It wins over the patterns.
+func (server *HTTPServer) AddHandler(path string, handler Handler) {
+	route := &gatewayRoute{
+		method:  AnyMethod,
+		pattern: path,
+		handler: handler,
+		literal: true,
+	}
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	for i, exist := range server.gatewayRoutes {
+		if exist.literal && exist.pattern == path {
+			server.gatewayRoutes[i] = route
+			return
+		}
+	}
+	server.gatewayRoutes = append(server.gatewayRoutes, route)
+}
+
+// RemoveRoute removes the route added for method and pattern.
+func (server *HTTPServer) RemoveRoute(method, pattern string) {
+	method = strings.ToUpper(method)
+	if method == "" {
+		method = AnyMethod
+	}
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	for i, route := range server.gatewayRoutes {
+		if route.method == method && route.pattern == pattern {
+			server.gatewayRoutes = append(server.gatewayRoutes[:i], server.gatewayRoutes[i+1:]...)
+			return
+		}
+	}
+}
+
+// MatchRoute returns the most specific route for method and path along with the path
+// parameters it captured.
+func (server *HTTPServer) MatchRoute(method, path string) (Handler, map[string]string, bool) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	method = strings.ToUpper(method)
+
+	server.lock.RLock()
+	defer server.lock.RUnlock()
+	var best *gatewayRoute
+	var bestParams map[string]string
+	for _, route := range server.gatewayRoutes {
+		if route.literal && route.pattern == path {
+			return route.handler, nil, true
+		}
+	}
+	for _, route := range server.gatewayRoutes {
+		if route.literal {
+			continue
+		}
+		params, ok := route.match(method, parts)
+		if !ok {
+			continue
+		}
+		if best == nil || route.moreSpecific(best) {
+			best, bestParams = route, params
+		}
+	}
+	if best == nil {
+		return nil, nil, false
+	}
+	return best.handler, bestParams, true
+}
+
+func (server *HTTPServer) GetHandler(path string) (Handler, bool) {
+	handler, params, ok := server.MatchRoute(AnyMethod, path)
+	if !ok {
+		return nil, false
+	}
+	return func(c HttpContext) {
+		handler(withPathParams(c, params))
+	}, true
+}
+
+// GatewayRoutes returns the routes added to the gateway sorted by pattern.
+func (server *HTTPServer) GatewayRoutes() []GatewayRoute {
+	server.lock.RLock()
+	defer server.lock.RUnlock()
+	routes := make([]GatewayRoute, 0, len(server.gatewayRoutes))
+	for _, route := range server.gatewayRoutes {
+		routes = append(routes, GatewayRoute{Method: route.method, Pattern: route.pattern})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// gatewayContext exposes the parameters captured by a gateway route through Param.
+type gatewayContext struct {
+	HttpContext
+	params map[string]string
+}
+
+func withPathParams(c HttpContext, params map[string]string) HttpContext {
+	if len(params) == 0 {
+		return c
+	}
+	return &gatewayContext{HttpContext: c, params: params}
+}
+
+func (c *gatewayContext) Param(key string) string {
+	if value, ok := c.params[key]; ok {
+		return value
+	}
+	if pc, ok := c.HttpContext.(HttpParamContext); ok {
+		return pc.Param(key)
+	}
+	return ""
+}
+
+func (server *HTTPServer) serveGateway(c HttpContext, method, path string) {
+	handler, params, ok := server.MatchRoute(method, path)
+	if !ok {
+		ErrorRet(c, NewCodeError(CodeNotFound, fmt.Sprintf("no handler for %s %s", method, path)))
+		return
+	}
+	handler(withPathParams(c, params))
+}
+
+// Gateway dispatches to plugin routes using the path query parameter. The method to
+// match is taken from the method query parameter and defaults to POST.
+func (server *HTTPServer) Gateway(c HttpContext) {
+	path := c.Query("path")
+	if path == "" {
+		ErrorRet(c, errMissingParam("path"))
+		return
+	}
+	escapedPath, _ := url.PathUnescape(path)
+
+	method := c.Query("method")
+	if method == "" {
+		method = "POST"
+	}
+	server.serveGateway(c, method, escapedPath)
+}
+
+// RegisterGateway mounts the gateway on {routePrefix}/plugin/gw, so that a plugin route
+// such as "GET /orders/{id}" is served at GET {routePrefix}/plugin/gw/orders/42. The
+// router must support a trailing "*path" catch-all parameter.
+func (server *HTTPServer) RegisterGateway(router HttpRouter, routePrefix string) {
+	mount := routePrefix + "/plugin/gw"
+	server.lock.Lock()
+	server.gatewayMounts = append(server.gatewayMounts, mount)
+	server.lock.Unlock()
+
+	routes := make([]Route, 0, len(GatewayMethods))
+	for _, method := range GatewayMethods {
+		method := method
+		routes = append(routes, Route{
+			Method:       method,
+			Path:         "/plugin/gw/*path",
+			Service:      true,
+			Permissions:  []Permission{PermRun},
+			undocumented: true,
+			handler: func(c HttpContext) {
+				path := PathParam(c, "path")
+				if !strings.HasPrefix(path, "/") {
+					path = "/" + path
+				}
+				server.serveGateway(c, method, path)
+			},
+		})
+	}
+	server.addRoutes(router, routePrefix, routes)
+}
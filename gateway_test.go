@@ -0,0 +1,120 @@
+package goplugify
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGatewayRouting(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+
+	add := func(method, pattern, name string) {
+		t.Helper()
+		err := server.AddRoute(method, pattern, func(c HttpContext) {
+			c.JSON(200, name+" "+PathParam(c, "id")+" "+PathParam(c, "*"))
+		})
+		if err != nil {
+			t.Fatalf("add route %s %s: %v", method, pattern, err)
+		}
+	}
+	add("GET", "/orders/{id}", "get-order")
+	add("DELETE", "/orders/{id}", "delete-order")
+	add("GET", "/orders/latest", "latest")
+	add(AnyMethod, "/orders/{id}", "any-order")
+	add("GET", "/static/*", "static")
+	add("GET", "/static/css/*", "css")
+	add("GET", "/static", "static-root")
+
+	tests := []struct {
+		method, path, want string
+	}{
+		{"GET", "/orders/42", "get-order 42 "},
+		{"DELETE", "/orders/42", "delete-order 42 "},
+		{"POST", "/orders/42", "any-order 42 "},
+		{"GET", "/orders/latest", "latest  "},
+		{"GET", "/static/js/app.js", "static  js/app.js"},
+		{"GET", "/static/css/app.css", "css  app.css"},
+		{"GET", "/static", "static-root  "},
+	}
+	for _, tt := range tests {
+		c := newTestContext()
+		server.serveGateway(c, tt.method, tt.path)
+		if c.status != 200 || c.resp != tt.want {
+			t.Errorf("%s %s: got %d %v, want %q", tt.method, tt.path, c.status, c.resp, tt.want)
+		}
+	}
+
+	c := newStatusTestContext()
+	server.serveGateway(c, "GET", "/missing")
+	if c.status != 404 {
+		t.Errorf("expected 404 for unknown path, got %d", c.status)
+	}
+
+	if err := server.AddRoute("GET", "/orders/{oid}", func(c HttpContext) {}); !errors.Is(err, ErrRouteConflict) {
+		t.Errorf("expected conflict, got %v", err)
+	}
+	if err := server.AddRoute("GET", "/a/*/b", func(c HttpContext) {}); CodeOf(err) != CodeInvalidRequest {
+		t.Errorf("expected invalid pattern, got %v", err)
+	}
+
+	server.RemoveRoute("GET", "/orders/{id}")
+	c = newTestContext()
+	server.serveGateway(c, "GET", "/orders/42")
+	if c.resp != "any-order 42 " {
+		t.Errorf("expected fallback to the any method route, got %v", c.resp)
+	}
+}
+
+func TestGatewayLegacyQuery(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	server.AddHandler("/hello world", func(c HttpContext) { c.JSON(200, "hello") })
+
+	c := newTestContext()
+	c.query["path"] = "/hello%20world"
+	server.Gateway(c)
+	if c.status != 200 || c.resp != "hello" {
+		t.Errorf("unexpected gateway response %d %v", c.status, c.resp)
+	}
+}
+
+func TestGatewayUnprefixedHandler(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	server.AddHandler("hello", func(c HttpContext) { c.JSON(200, "hello") })
+	server.AddHandler("report/{year}", func(c HttpContext) { c.JSON(200, "report") })
+	server.AddRoute("GET", "/{name}", func(c HttpContext) { c.JSON(200, "pattern") })
+
+	for path, want := range map[string]string{"hello": "hello", "report/{year}": "report", "/hello": "pattern"} {
+		c := newTestContext()
+		c.query["path"] = path
+		c.query["method"] = "GET"
+		server.Gateway(c)
+		if c.status != 200 || c.resp != want {
+			t.Errorf("%s: expected %s, got %d %v", path, want, c.status, c.resp)
+		}
+	}
+
+	c := newStatusTestContext()
+	c.query["path"] = "report/2024"
+	server.Gateway(c)
+	if c.status != 404 {
+		t.Errorf("expected a literal key not to match as a pattern, got %d %v", c.status, c.resp)
+	}
+}
+
+func TestGatewayMount(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	router := newTestRouter()
+	server.RegisterGateway(router, "/api/v1")
+	server.AddRoute("PUT", "/orders/{id}", func(c HttpContext) { c.JSON(200, PathParam(c, "id")) })
+
+	handler, ok := router.routes["PUT /api/v1/plugin/gw/*path"]
+	if !ok {
+		t.Fatalf("gateway not mounted: %v", router.routes)
+	}
+	c := newTestContext()
+	c.params["path"] = "orders/7"
+	handler(c)
+	if c.status != 200 || c.resp != "7" {
+		t.Errorf("unexpected mounted response %d %v", c.status, c.resp)
+	}
+}
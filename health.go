@@ -0,0 +1,260 @@
+package goplugify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	DefaultHealthInterval = 30 * time.Second
+	DefaultHealthTimeout  = 5 * time.Second
+)
+
+// HealthChecker is implemented by the exports of plugins that can tell whether they
+// work, a nil error means healthy. Yaegi scripts export it as a Health function of
+// the same signature.
+type HealthChecker interface {
+	Health(ctx context.Context) error
+}
+
+func healthOf(exports any) func(context.Context) error {
+	if checker, ok := exports.(HealthChecker); ok {
+		return checker.Health
+	}
+	return nil
+}
+
+// HealthStatus is the result of the last health check of a plugin.
+type HealthStatus struct {
+	Healthy   bool      `json:"healthy"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	// Failures counts the consecutive failed checks.
+	Failures int `json:"failures,omitempty"`
+}
+
+const (
+	HealthOK          = "ok"
+	HealthDegraded    = "degraded"
+	HealthUnavailable = "unavailable"
+
+	PluginHealthy   = "healthy"
+	PluginUnhealthy = "unhealthy"
+	PluginPending   = "pending"
+)
+
+// HealthReport aggregates the health of the plugins of every service. Status is
+// unavailable when a critical plugin is unhealthy and degraded when another one is.
+type HealthReport struct {
+	Status   string          `json:"status"`
+	Services []ServiceHealth `json:"services"`
+}
+
+type ServiceHealth struct {
+	Name    string         `json:"name"`
+	Status  string         `json:"status"`
+	Plugins []PluginHealth `json:"plugins"`
+}
+
+// PluginHealth is the health of a plugin with a health check, Status is pending
+// until the first check returns.
+type PluginHealth struct {
+	ID        string     `json:"id"`
+	Critical  bool       `json:"critical,omitempty"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+// healthMonitor polls the health checks of the plugins of a manager.
+type healthMonitor struct {
+	entries map[string]*healthEntry
+	lock    sync.Mutex
+}
+
+type healthEntry struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type healthTarget interface {
+	healthCheck() func(context.Context) error
+	setHealth(*HealthStatus)
+}
+
+// set starts polling the health check of plugin, replacing the polling of the
+// version it had. The status of the previous version is dropped.
+func (m *healthMonitor) set(plugin IPlugin) {
+	id := plugin.Meta().ID
+	m.stop(id)
+	target, ok := plugin.(healthTarget)
+	if !ok {
+		return
+	}
+	target.setHealth(nil)
+	check := target.healthCheck()
+	if check == nil {
+		return
+	}
+	interval := DefaultHealthInterval
+	if d, err := time.ParseDuration(plugin.Meta().HealthInterval); err == nil {
+		interval = d
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	entry := &healthEntry{cancel: cancel, done: make(chan struct{})}
+	m.lock.Lock()
+	if m.entries == nil {
+		m.entries = make(map[string]*healthEntry)
+	}
+	m.entries[id] = entry
+	m.lock.Unlock()
+
+	go func() {
+		defer close(entry.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var failures int
+		for {
+			status := runHealthCheck(ctx, check)
+			if ctx.Err() != nil {
+				return
+			}
+			if status.Healthy {
+				failures = 0
+			} else {
+				failures++
+			}
+			status.Failures = failures
+			target.setHealth(status)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stop ends the polling of pluginID and waits for it to exit.
+func (m *healthMonitor) stop(pluginID string) {
+	m.lock.Lock()
+	entry, ok := m.entries[pluginID]
+	delete(m.entries, pluginID)
+	m.lock.Unlock()
+	if !ok {
+		return
+	}
+	entry.cancel()
+	<-entry.done
+}
+
+// runHealthCheck gives up on check when ctx ends, a check ignoring its context
+// cannot hold the monitor, nor the manager stopping it.
+func runHealthCheck(ctx context.Context, check func(context.Context) error) *HealthStatus {
+	ctx, cancel := context.WithTimeout(ctx, DefaultHealthTimeout)
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				result <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		result <- check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	status := &HealthStatus{Healthy: err == nil, CheckedAt: time.Now()}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
+
+func validateHealthInterval(meta *Meta) error {
+	if meta.HealthInterval == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(meta.HealthInterval)
+	if err != nil || d < time.Second {
+		return fmt.Errorf("invalid health_interval %q, at least 1s is required", meta.HealthInterval)
+	}
+	return nil
+}
+
+// pluginHealth reports nil for plugins without a health check.
+func pluginHealth(plugin IPlugin) *PluginHealth {
+	target, ok := plugin.(healthTarget)
+	if !ok || target.healthCheck() == nil {
+		return nil
+	}
+	meta := plugin.Meta()
+	health := &PluginHealth{ID: meta.ID, Critical: meta.Critical, Status: PluginPending}
+	if status := StatsOf(plugin).Health; status != nil {
+		health.Status = PluginHealthy
+		if !status.Healthy {
+			health.Status = PluginUnhealthy
+		}
+		health.Error = status.Error
+		health.CheckedAt = &status.CheckedAt
+	}
+	return health
+}
+
+// HealthReport returns the health of the plugins of every service.
+func (server *HTTPServer) HealthReport() *HealthReport {
+	report := &HealthReport{Status: HealthOK, Services: []ServiceHealth{}}
+	for _, name := range server.registry.Names() {
+		manager, ok := server.registry.Get(name)
+		if !ok {
+			continue
+		}
+		service := ServiceHealth{Name: name, Status: HealthOK, Plugins: []PluginHealth{}}
+		page, _ := QueryPlugins(manager.ListPlugins(), ListOptions{})
+		for _, plugin := range page.Plugins {
+			health := pluginHealth(plugin)
+			if health == nil {
+				continue
+			}
+			service.Plugins = append(service.Plugins, *health)
+			if health.Status != PluginUnhealthy {
+				continue
+			}
+			if health.Critical {
+				service.Status = HealthUnavailable
+			} else if service.Status == HealthOK {
+				service.Status = HealthDegraded
+			}
+		}
+		if service.Status == HealthUnavailable || report.Status == HealthOK {
+			report.Status = service.Status
+		}
+		report.Services = append(report.Services, service)
+	}
+	return report
+}
+
+// RegisterHealth registers GET {prefix}/plugin/health, answering 503 while a
+// critical plugin is unhealthy. Load balancer probes do not sign their requests,
+// so router is usually not authenticated.
+func (server *HTTPServer) RegisterHealth(router HttpRouter, routePrefix string) {
+	server.addRoutes(router, routePrefix, []Route{
+		{Method: "GET", Path: "/plugin/health", Summary: "Health of the plugins of every service, 503 when a critical plugin is unhealthy", Response: "HealthReport", Permissions: []Permission{PermList}, handler: server.Health},
+	})
+}
+
+func (server *HTTPServer) Health(c HttpContext) {
+	report := server.HealthReport()
+	status := 200
+	if report.Status == HealthUnavailable {
+		status = 503
+	}
+	c.JSON(status, report)
+}
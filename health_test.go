@@ -0,0 +1,151 @@
+package goplugify
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func waitHealth(t *testing.T, server *HTTPServer, status string) *HealthReport {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		report := server.HealthReport()
+		if report.Status == status {
+			return report
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected health %s, got %+v", status, report)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHealthReport(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	server.Registry().Add("billing", NewPluginManager("billing"))
+	manager := server.Registry().managers["default"].(*PluginManager)
+
+	var broken atomic.Bool
+	plugin := &Plugin{
+		MetaInfo: &Meta{ID: "db", Critical: true, HealthInterval: "1s"},
+		health: func(ctx context.Context) error {
+			if broken.Load() {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+	}
+	manager.AddPlugin(plugin)
+	manager.AddPlugin(&Plugin{MetaInfo: &Meta{ID: "plain"}})
+	manager.watch(plugin)
+	defer manager.unwatch("db")
+
+	for deadline := time.Now().Add(3 * time.Second); StatsOf(plugin).Health == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	report := waitHealth(t, server, HealthOK)
+	if len(report.Services) != 2 || len(report.Services[1].Plugins) != 1 || report.Services[1].Plugins[0].Status != PluginHealthy {
+		t.Fatalf("expected only the plugin with a health check, got %+v", report)
+	}
+
+	broken.Store(true)
+	report = waitHealth(t, server, HealthUnavailable)
+	if got := report.Services[1].Plugins[0]; got.Status != PluginUnhealthy || got.Error != "connection refused" {
+		t.Errorf("unexpected plugin health %+v", got)
+	}
+	if StatsOf(plugin).Health.Failures < 1 {
+		t.Errorf("expected the failures to be counted, got %+v", StatsOf(plugin).Health)
+	}
+	c := newTestContext()
+	server.Health(c)
+	if c.status != 503 {
+		t.Errorf("expected 503 while a critical plugin is unhealthy, got %d", c.status)
+	}
+
+	plugin.stateLock.Lock()
+	plugin.MetaInfo = &Meta{ID: "db", HealthInterval: "1s"}
+	plugin.stateLock.Unlock()
+	manager.watch(plugin)
+	waitHealth(t, server, HealthDegraded)
+	c = newTestContext()
+	server.Health(c)
+	if c.status != 200 {
+		t.Errorf("expected 200 when only a non critical plugin is unhealthy, got %d", c.status)
+	}
+}
+
+func TestHealthYaegi(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	c := newTestContext()
+	c.params["id"] = "checked"
+	c.form["meta"] = `{"loader": "yaegi_http", "critical": true}`
+	c.body = []byte(`package main
+
+import (
+	"context"
+	"errors"
+)
+
+func Run(input map[string]any) (any, error) { return nil, nil }
+
+func Methods() map[string]func(any) any { return nil }
+
+func Destroy(input map[string]any) error { return nil }
+
+func Health(ctx context.Context) error { return errors.New("cache is down") }
+`)
+	server.putPluginV2(c)
+	if c.status != 201 {
+		t.Fatalf("put: %d %v", c.status, c.resp)
+	}
+	report := waitHealth(t, server, HealthUnavailable)
+	if got := report.Services[0].Plugins[0]; got.ID != "checked" || got.Error != "cache is down" {
+		t.Errorf("unexpected plugin health %+v", got)
+	}
+
+	c = newTestContext()
+	c.params["id"] = "checked"
+	server.deletePluginV2(c)
+	waitHealth(t, server, HealthOK)
+
+	c = newTestContext()
+	c.params["id"] = "bad"
+	c.form["meta"] = `{"loader": "yaegi_http", "health_interval": "10ms"}`
+	c.body = []byte(testScript)
+	server.putPluginV2(c)
+	if c.status != 400 {
+		t.Errorf("expected 400 for a too short health interval, got %d", c.status)
+	}
+}
+
+func TestHealthCheckIgnoringContext(t *testing.T) {
+	manager := NewPluginManager("default")
+	started := make(chan struct{})
+	block := make(chan struct{})
+	defer close(block)
+	plugin := &Plugin{
+		MetaInfo: &Meta{ID: "stuck", HealthInterval: "1s"},
+		health: func(ctx context.Context) error {
+			close(started)
+			<-block
+			return nil
+		},
+	}
+	manager.AddPlugin(plugin)
+	manager.watch(plugin)
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		manager.unwatch("stuck")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected a health check ignoring its context not to block unwatch")
+	}
+}
@@ -0,0 +1,399 @@
+package goplugify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCanceled  JobStatus = "canceled"
+)
+
+const (
+	DefaultJobWorkers   = 4
+	DefaultJobQueueSize = 128
+	DefaultJobTTL       = time.Hour
+)
+
+var ErrJobQueueFull = NewCodeError(CodeUnavailable, "job queue is full")
+
+// Job is an asynchronous plugin run.
+type Job struct {
+	ID         string     `json:"id"`
+	Service    string     `json:"service"`
+	PluginID   string     `json:"plugin_id"`
+	Status     JobStatus  `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Duration is the run time in milliseconds.
+	Duration int64     `json:"duration_ms,omitempty"`
+	Result   any       `json:"result,omitempty"`
+	Error    *APIError `json:"error,omitempty"`
+
+	run    func(ctx context.Context) (any, error)
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (j *Job) finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCanceled
+}
+
+// JobQueue runs jobs on a bounded pool of workers and keeps finished jobs for TTL.
+type JobQueue struct {
+	workers int
+	ttl     time.Duration
+	queue   chan *Job
+	jobs    map[string]*Job
+	start   sync.Once
+	lock    sync.RWMutex
+}
+
+func NewJobQueue(workers, queueSize int, ttl time.Duration) *JobQueue {
+	if workers <= 0 {
+		workers = DefaultJobWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultJobQueueSize
+	}
+	if ttl <= 0 {
+		ttl = DefaultJobTTL
+	}
+	return &JobQueue{
+		workers: workers,
+		ttl:     ttl,
+		queue:   make(chan *Job, queueSize),
+		jobs:    make(map[string]*Job),
+	}
+}
+
+// Submit queues run and returns the job tracking it. The context passed to run is
+// canceled by Cancel.
+func (q *JobQueue) Submit(service, pluginID string, run func(ctx context.Context) (any, error)) (Job, error) {
+	q.start.Do(func() {
+		for range q.workers {
+			go q.work()
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		ID:        newJobID(),
+		Service:   service,
+		PluginID:  pluginID,
+		Status:    JobQueued,
+		CreatedAt: time.Now(),
+		run:       run,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+
+	q.lock.Lock()
+	q.prune()
+	q.jobs[job.ID] = job
+	q.lock.Unlock()
+
+	select {
+	case q.queue <- job:
+		return q.snapshot(job), nil
+	default:
+		cancel()
+		q.lock.Lock()
+		delete(q.jobs, job.ID)
+		q.lock.Unlock()
+		return Job{}, ErrJobQueueFull
+	}
+}
+
+func (q *JobQueue) work() {
+	for job := range q.queue {
+		q.lock.Lock()
+		if job.Status != JobQueued {
+			q.lock.Unlock()
+			continue
+		}
+		now := time.Now()
+		job.Status = JobRunning
+		job.StartedAt = &now
+		q.lock.Unlock()
+
+		result, err := q.runJob(job)
+
+		q.lock.Lock()
+		end := time.Now()
+		job.FinishedAt = &end
+		job.Duration = end.Sub(now).Milliseconds()
+		switch {
+		case job.ctx.Err() != nil:
+			job.Status = JobCanceled
+			job.Error = toAPIError(WrapError(CodeCanceled, "run", job.PluginID, job.ctx.Err()))
+		case err != nil:
+			job.Status = JobFailed
+			job.Error = toAPIError(WrapError(CodeRunFailed, "run", job.PluginID, err))
+		default:
+			job.Status = JobSucceeded
+			job.Result = result
+		}
+		q.lock.Unlock()
+		job.cancel()
+	}
+}
+
+func (q *JobQueue) runJob(job *Job) (result any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("plugin panic: %v", r)
+		}
+	}()
+	return job.run(job.ctx)
+}
+
+// Get returns the job with id.
+func (q *JobQueue) Get(id string) (Job, bool) {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// Cancel cancels a queued or running job. A running job stops once the plugin
+// returns, plugins are expected to watch the context of their input.
+func (q *JobQueue) Cancel(id string) (Job, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, NewCodeError(CodeNotFound, fmt.Sprintf("job %s not found", id))
+	}
+	if job.finished() {
+		return *job, NewCodeError(CodeConflict, fmt.Sprintf("job %s already %s", id, job.Status))
+	}
+	job.cancel()
+	if job.Status == JobQueued {
+		now := time.Now()
+		job.Status = JobCanceled
+		job.FinishedAt = &now
+	}
+	return *job, nil
+}
+
+// List returns the retained jobs of pluginID in service, or of every plugin when
+// pluginID is empty, newest first.
+func (q *JobQueue) List(service, pluginID string) []Job {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.prune()
+	jobs := make([]Job, 0)
+	for _, job := range q.jobs {
+		if job.Service != service || (pluginID != "" && job.PluginID != pluginID) {
+			continue
+		}
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+func (q *JobQueue) snapshot(job *Job) Job {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	return *job
+}
+
+// prune drops finished jobs older than the TTL, the caller holds the lock.
+func (q *JobQueue) prune() {
+	for id, job := range q.jobs {
+		if job.finished() && job.FinishedAt != nil && time.Since(*job.FinishedAt) > q.ttl {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+func newJobID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// HttpRequestContext is implemented by contexts that expose the underlying request.
+type HttpRequestContext interface {
+	Request() *http.Request
+}
+
+// detachedContext is a copy of a request that outlives it, used as the input of
+// asynchronous runs. Headers, query and form values are only available when the
+// original context implements HttpRequestContext.
+type detachedContext struct {
+	context.Context
+
+	body   []byte
+	header http.Header
+	query  url.Values
+	form   url.Values
+	params map[string]string
+
+	lock    sync.Mutex
+	written any
+}
+
+func detachContext(ctx context.Context, c HttpContext, limit int64) (*detachedContext, error) {
+	body, err := readBody(c, limit)
+	if err != nil {
+		return nil, err
+	}
+	dc := &detachedContext{
+		Context: ctx,
+		body:    body,
+		header:  http.Header{},
+		query:   url.Values{},
+		form:    url.Values{},
+	}
+	if rc, ok := c.(HttpRequestContext); ok && rc.Request() != nil {
+		req := rc.Request()
+		dc.header = req.Header.Clone()
+		dc.query = req.URL.Query()
+		for k, v := range req.PostForm {
+			dc.form[k] = append([]string(nil), v...)
+		}
+	}
+	return dc, nil
+}
+
+// newEmptyContext is the Raw context of runs not started by a request.
+func newEmptyContext(ctx context.Context) *detachedContext {
+	return &detachedContext{
+		Context: ctx,
+		header:  http.Header{},
+		query:   url.Values{},
+		form:    url.Values{},
+	}
+}
+
+func (c *detachedContext) GetHeader(key string) string { return c.header.Get(key) }
+func (c *detachedContext) Body() io.ReadCloser         { return io.NopCloser(bytes.NewReader(c.body)) }
+func (c *detachedContext) FormFile(name string) (*multipart.FileHeader, error) {
+	return nil, http.ErrMissingFile
+}
+func (c *detachedContext) Query(key string) string    { return c.query.Get(key) }
+func (c *detachedContext) PostForm(key string) string { return c.form.Get(key) }
+
+// JSON records the value written by plugins that answer through the context instead
+// of returning a result.
+func (c *detachedContext) JSON(code int, obj any) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.written = obj
+}
+
+// runAsync runs req as a job, its Raw context is replaced by a copy that outlives
+// the request.
+func (server *HTTPServer) runAsync(c HttpContext, req *RunRequest, plugin IPlugin) {
+	detached, err := detachContext(context.Background(), req.Raw, server.maxBodySize())
+	if err != nil {
+		ErrorRet(c, err)
+		return
+	}
+	job, err := server.jobQueue().Submit(req.Service, req.PluginID, func(ctx context.Context) (any, error) {
+		detached.Context = ctx
+		async := *req
+		async.Context = ctx
+		async.Raw = detached
+		resp, err := plugin.OnRun(&async)
+		if resp == nil && err == nil {
+			detached.lock.Lock()
+			resp = detached.written
+			detached.lock.Unlock()
+		}
+		return resp, err
+	})
+	if err != nil {
+		ErrorRet(c, err)
+		return
+	}
+	c.JSON(202, job)
+}
+
+// SetJobQueue replaces the queue running asynchronous plugin runs. The jobs of the
+// previous queue are no longer reported.
+func (server *HTTPServer) SetJobQueue(queue *JobQueue) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.jobs = queue
+}
+
+func (server *HTTPServer) jobQueue() *JobQueue {
+	server.lock.RLock()
+	defer server.lock.RUnlock()
+	return server.jobs
+}
+
+// Job returns the status, timing and result of the job given by the id query parameter.
+func (server *HTTPServer) Job(c HttpContext) {
+	job, err := server.serviceJob(c)
+	if err != nil {
+		ErrorRet(c, err)
+		return
+	}
+	c.JSON(200, job)
+}
+
+func (server *HTTPServer) CancelJob(c HttpContext) {
+	job, err := server.serviceJob(c)
+	if err != nil {
+		ErrorRet(c, err)
+		return
+	}
+	job, err = server.jobQueue().Cancel(job.ID)
+	if err != nil {
+		ErrorRet(c, err)
+		return
+	}
+	c.JSON(200, job)
+}
+
+// serviceJob returns the job of the id query parameter, the jobs of the other
+// services, or of another plugin than the plugin_id query, are not found.
+func (server *HTTPServer) serviceJob(c HttpContext) (Job, error) {
+	id := c.Query("id")
+	if id == "" {
+		return Job{}, errMissingParam("id")
+	}
+	job, ok := server.jobQueue().Get(id)
+	// plugin_id is what the request was authorized for, see withAuthorization.
+	pluginID := c.Query("plugin_id")
+	if !ok || job.Service != server.getService(c) || pluginID != "" && job.PluginID != pluginID {
+		return Job{}, NewCodeError(CodeNotFound, fmt.Sprintf("job %s not found", id))
+	}
+	return job, nil
+}
+
+// Jobs lists the retained jobs of a service, filtered by the optional plugin_id.
+func (server *HTTPServer) Jobs(c HttpContext) {
+	if _, err := server.getManager(c); err != nil {
+		ErrorRet(c, err)
+		return
+	}
+	c.JSON(200, server.jobQueue().List(server.getService(c), c.Query("plugin_id")))
+}
@@ -0,0 +1,128 @@
+package goplugify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func waitJob(t *testing.T, q *JobQueue, id string, status JobStatus) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, ok := q.Get(id); ok && job.Status == status {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	job, _ := q.Get(id)
+	t.Fatalf("job %s did not reach %s, last %+v", id, status, job)
+	return job
+}
+
+func TestJobQueue(t *testing.T) {
+	q := NewJobQueue(1, 1, time.Hour)
+
+	started := make(chan struct{})
+	running, err := q.Submit("default", "slow", func(ctx context.Context) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	<-started
+
+	queued, err := q.Submit("default", "fast", func(ctx context.Context) (any, error) {
+		return "done", nil
+	})
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if _, err := q.Submit("default", "fast", nil); !errors.Is(err, ErrJobQueueFull) {
+		t.Fatalf("expected a full queue, got %v", err)
+	}
+
+	if _, err := q.Cancel(running.ID); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	job := waitJob(t, q, running.ID, JobCanceled)
+	if job.Error == nil || job.Error.Code != CodeCanceled {
+		t.Errorf("expected a canceled error, got %+v", job.Error)
+	}
+
+	job = waitJob(t, q, queued.ID, JobSucceeded)
+	if job.Result != "done" || job.StartedAt == nil || job.FinishedAt == nil {
+		t.Errorf("unexpected finished job %+v", job)
+	}
+	if _, err := q.Cancel(queued.ID); CodeOf(err) != CodeConflict {
+		t.Errorf("expected a conflict canceling a finished job, got %v", err)
+	}
+
+	if jobs := q.List("default", "fast"); len(jobs) != 1 || jobs[0].ID != queued.ID {
+		t.Errorf("unexpected jobs of plugin fast: %+v", jobs)
+	}
+	if jobs := q.List("default", ""); len(jobs) != 2 {
+		t.Errorf("expected 2 jobs, got %+v", jobs)
+	}
+}
+
+func TestRunAsync(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	c := putTestPlugin(t, server, "demo", LoaderTypeYaegiHTTP)
+	if c.status != 201 {
+		t.Fatalf("load plugin: %d %v", c.status, c.resp)
+	}
+
+	c = newTestContext()
+	c.query["plugin_id"] = "demo"
+	c.query["async"] = "true"
+	server.Run(c)
+	if c.status != 202 {
+		t.Fatalf("expected 202, got %d %v", c.status, c.resp)
+	}
+	job := c.resp.(Job)
+	job = waitJob(t, server.jobs, job.ID, JobSucceeded)
+	if job.Result != "ran" {
+		t.Errorf("unexpected result %v", job.Result)
+	}
+
+	c = newTestContext()
+	c.query["id"] = job.ID
+	server.Job(c)
+	if c.status != 200 || c.resp.(Job).Status != JobSucceeded {
+		t.Errorf("unexpected job response %d %v", c.status, c.resp)
+	}
+
+	server.Registry().Add("billing", NewPluginManager("billing"))
+	for _, handler := range []Handler{server.Job, server.CancelJob} {
+		c = newStatusTestContext()
+		c.query["id"] = job.ID
+		c.query["service"] = "billing"
+		handler(c)
+		if c.status != 404 {
+			t.Errorf("expected the job of another service to be not found, got %d %v", c.status, c.resp)
+		}
+	}
+}
+
+func TestSetJobQueueWhileServing(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			server.SetJobQueue(NewJobQueue(1, 1, time.Hour))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		c := newTestContext()
+		server.Jobs(c)
+		if c.status != 200 {
+			t.Fatalf("unexpected jobs response %d: %v", c.status, c.resp)
+		}
+	}
+	<-done
+}
@@ -0,0 +1,220 @@
+package goplugify
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	ListSortID          = "id"
+	ListSortInstallTime = "install_time"
+	ListSortRunTime     = "run_time"
+	ListSortRunTimes    = "run_times"
+)
+
+// ListOptions selects, orders and pages the plugins of a listing. Empty filters
+// match every plugin.
+type ListOptions struct {
+	Loader LoaderType
+	Author string
+	State  PluginState
+	Tag    string
+	// Prefix matches the beginning of the ID or the name.
+	Prefix string
+
+	// Sort is one of the ListSort constants, ListSortID when empty. Plugins with
+	// the same sort key are ordered by ID.
+	Sort string
+	Desc bool
+
+	// Cursor is the NextCursor of the previous page.
+	Cursor string
+	// Limit is the page size, zero for no limit.
+	Limit int
+}
+
+// PluginPage is a page of a listing, NextCursor is empty on the last page.
+type PluginPage struct {
+	Plugins    []IPlugin `json:"plugins"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// PluginDetail is a plugin with its full meta and the names of its methods.
+type PluginDetail struct {
+	Meta *Meta `json:"meta"`
+	PluginStats
+	Methods []string `json:"methods"`
+}
+
+// listCursor is the position after the last plugin of a page.
+type listCursor struct {
+	Key int64  `json:"k,omitempty"`
+	ID  string `json:"id"`
+}
+
+// QueryPlugins filters, sorts and pages plugins. Pages stay consistent while plugins
+// come and go since the cursor holds the sort key of the last plugin, not an offset.
+func QueryPlugins(plugins []IPlugin, opts ListOptions) (*PluginPage, error) {
+	sortKey, ok := listSortKeys[opts.Sort]
+	if !ok {
+		return nil, NewCodeError(CodeInvalidRequest, "unknown sort "+opts.Sort)
+	}
+	var after *listCursor
+	if opts.Cursor != "" {
+		data, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+		after = new(listCursor)
+		if err != nil || json.Unmarshal(data, after) != nil {
+			return nil, NewCodeError(CodeInvalidRequest, "invalid cursor")
+		}
+	}
+
+	type entry struct {
+		plugin IPlugin
+		cursor listCursor
+	}
+	var entries []entry
+	for _, plugin := range plugins {
+		meta, stats := plugin.Meta(), StatsOf(plugin)
+		if !matchPlugin(meta, stats, opts) {
+			continue
+		}
+		entries = append(entries, entry{plugin, listCursor{Key: sortKey(stats), ID: meta.ID}})
+	}
+	less := func(a, b listCursor) bool {
+		if a.Key != b.Key {
+			return a.Key < b.Key != opts.Desc
+		}
+		return a.ID < b.ID != opts.Desc
+	}
+	sort.Slice(entries, func(i, j int) bool { return less(entries[i].cursor, entries[j].cursor) })
+
+	page := &PluginPage{Plugins: []IPlugin{}}
+	var last listCursor
+	for _, e := range entries {
+		if after != nil && !less(*after, e.cursor) {
+			continue
+		}
+		if opts.Limit > 0 && len(page.Plugins) == opts.Limit {
+			data, _ := json.Marshal(last)
+			page.NextCursor = base64.RawURLEncoding.EncodeToString(data)
+			break
+		}
+		page.Plugins = append(page.Plugins, e.plugin)
+		last = e.cursor
+	}
+	return page, nil
+}
+
+var listSortKeys = map[string]func(PluginStats) int64{
+	"":                  func(PluginStats) int64 { return 0 },
+	ListSortID:          func(PluginStats) int64 { return 0 },
+	ListSortInstallTime: func(s PluginStats) int64 { return s.InstallTime.UnixNano() },
+	ListSortRunTime:     func(s PluginStats) int64 { return s.RunTime.UnixNano() },
+	ListSortRunTimes:    func(s PluginStats) int64 { return int64(s.RunTimes) },
+}
+
+func matchPlugin(meta *Meta, stats PluginStats, opts ListOptions) bool {
+	if opts.Loader != "" && meta.Loader != opts.Loader {
+		return false
+	}
+	if opts.Author != "" && meta.Author != opts.Author {
+		return false
+	}
+	if opts.State != "" && stats.State != opts.State {
+		return false
+	}
+	if opts.Prefix != "" && !strings.HasPrefix(meta.ID, opts.Prefix) && !strings.HasPrefix(meta.Name, opts.Prefix) {
+		return false
+	}
+	if opts.Tag != "" {
+		for _, tag := range meta.Tags {
+			if tag == opts.Tag {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+var listParams = []string{"loader", "author", "state", "tag", "prefix", "sort", "order", "cursor", "limit"}
+
+// listOptions reads the ListOptions of the query parameters loader, author, state,
+// tag, prefix, sort, order (asc or desc), cursor and limit.
+func listOptions(c HttpContext) (ListOptions, error) {
+	opts := ListOptions{
+		Loader: LoaderType(c.Query("loader")),
+		Author: c.Query("author"),
+		State:  PluginState(c.Query("state")),
+		Tag:    c.Query("tag"),
+		Prefix: c.Query("prefix"),
+		Sort:   c.Query("sort"),
+		Cursor: c.Query("cursor"),
+	}
+	switch c.Query("order") {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, NewCodeError(CodeInvalidRequest, "order must be asc or desc")
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return opts, NewCodeError(CodeInvalidRequest, "limit must be a positive integer")
+		}
+		opts.Limit = n
+	}
+	return opts, nil
+}
+
+// listPlugins answers a listing: a plain array of plugins for the clients of the
+// original route, or a PluginPage when the client pages with limit or cursor.
+func (server *HTTPServer) listPlugins(c HttpContext) (any, error) {
+	manager, err := server.getManager(c)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := listOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	page, err := QueryPlugins(manager.ListPlugins(), opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Limit == 0 && opts.Cursor == "" {
+		return page.Plugins, nil
+	}
+	return page, nil
+}
+
+func (server *HTTPServer) Get(c HttpContext) {
+	manager, err := server.getManager(c)
+	if err != nil {
+		ErrorRet(c, err)
+		return
+	}
+	pluginID := c.Query("plugin_id")
+	if pluginID == "" {
+		ErrorRet(c, errMissingParam("plugin_id"))
+		return
+	}
+	plugin, err := manager.GetPlugin(pluginID)
+	if err != nil {
+		ErrorRet(c, prefixError("get plugin error", err))
+		return
+	}
+	c.JSON(200, pluginDetail(plugin))
+}
+
+func pluginDetail(plugin IPlugin) *PluginDetail {
+	detail := &PluginDetail{Meta: plugin.Meta(), PluginStats: StatsOf(plugin), Methods: []string{}}
+	if mp, ok := plugin.(interface{ MethodNames() []string }); ok {
+		detail.Methods = mp.MethodNames()
+	}
+	return detail
+}
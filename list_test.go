@@ -0,0 +1,143 @@
+package goplugify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryPlugins(t *testing.T) {
+	now := time.Now()
+	plugins := []IPlugin{
+		&Plugin{MetaInfo: &Meta{ID: "c", Author: "ann", Loader: LoaderTypeNativePluginHTTP, Tags: []string{"ops"}}, InstallTime: now, RunTimes: 5},
+		&Plugin{MetaInfo: &Meta{ID: "a", Author: "bob", Loader: LoaderTypeYaegiHTTP}, InstallTime: now.Add(time.Second), RunTimes: 1},
+		&Plugin{MetaInfo: &Meta{ID: "b", Name: "report", Author: "ann", Loader: LoaderTypeYaegiHTTP, Tags: []string{"ops", "daily"}}, InstallTime: now.Add(-time.Second), RunTimes: 5},
+		&Plugin{MetaInfo: &Meta{ID: "d", Loader: LoaderTypeNativePluginHTTP}, State: PluginStateRunning, InstallTime: now},
+	}
+	ids := func(page *PluginPage) []string {
+		var ids []string
+		for _, p := range page.Plugins {
+			ids = append(ids, p.Meta().ID)
+		}
+		return ids
+	}
+	tests := []struct {
+		opts ListOptions
+		want []string
+	}{
+		{ListOptions{}, []string{"a", "b", "c", "d"}},
+		{ListOptions{Desc: true}, []string{"d", "c", "b", "a"}},
+		{ListOptions{Author: "ann"}, []string{"b", "c"}},
+		{ListOptions{Loader: LoaderTypeNativePluginHTTP}, []string{"c", "d"}},
+		{ListOptions{Tag: "ops"}, []string{"b", "c"}},
+		{ListOptions{State: PluginStateIdle}, []string{"a", "b", "c"}},
+		{ListOptions{State: PluginStateRunning}, []string{"d"}},
+		{ListOptions{Prefix: "rep"}, []string{"b"}},
+		{ListOptions{Sort: ListSortInstallTime}, []string{"b", "c", "d", "a"}},
+		{ListOptions{Sort: ListSortRunTimes, Desc: true}, []string{"c", "b", "a", "d"}},
+	}
+	for _, tt := range tests {
+		page, err := QueryPlugins(plugins, tt.opts)
+		if err != nil {
+			t.Fatalf("%+v: %v", tt.opts, err)
+		}
+		if got := ids(page); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%+v: expected %v, got %v", tt.opts, tt.want, got)
+		}
+	}
+
+	opts := ListOptions{Sort: ListSortRunTimes, Limit: 2}
+	var all []string
+	for i := 0; i < 3; i++ {
+		page, err := QueryPlugins(plugins, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, ids(page)...)
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	if fmt.Sprint(all) != "[d a b c]" {
+		t.Errorf("expected every plugin once in order, got %v", all)
+	}
+
+	if _, err := QueryPlugins(plugins, ListOptions{Sort: "size"}); CodeOf(err) != CodeInvalidRequest {
+		t.Errorf("expected an unknown sort to be rejected, got %v", err)
+	}
+	if _, err := QueryPlugins(plugins, ListOptions{Cursor: "!"}); CodeOf(err) != CodeInvalidRequest {
+		t.Errorf("expected an invalid cursor to be rejected, got %v", err)
+	}
+}
+
+func TestListAndGetRoutes(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	putTestPlugin(t, server, "demo", LoaderTypeYaegiHTTP)
+	putTestPlugin(t, server, "other", LoaderTypeYaegiHTTP)
+
+	c := newTestContext()
+	server.List(c)
+	if plugins, ok := c.resp.([]IPlugin); c.status != 200 || !ok || len(plugins) != 2 || plugins[0].Meta().ID != "demo" {
+		t.Fatalf("expected a sorted array, got %d: %v", c.status, c.resp)
+	}
+
+	c = newTestContext()
+	c.query["limit"] = "1"
+	server.List(c)
+	page, ok := c.resp.(*PluginPage)
+	if !ok || len(page.Plugins) != 1 || page.NextCursor == "" {
+		t.Fatalf("expected a page, got %d: %v", c.status, c.resp)
+	}
+
+	c = newStatusTestContext()
+	c.query["limit"] = "0"
+	server.List(c)
+	if c.status != 400 {
+		t.Errorf("expected 400 for an invalid limit, got %d", c.status)
+	}
+
+	c = newTestContext()
+	c.query["plugin_id"] = "demo"
+	server.Get(c)
+	detail, ok := c.resp.(*PluginDetail)
+	if c.status != 200 || !ok || detail.Meta.ID != "demo" || len(detail.Methods) != 1 || detail.Methods[0] != "echo" || detail.State != PluginStateIdle {
+		t.Fatalf("unexpected detail %d: %+v", c.status, c.resp)
+	}
+
+	c = newStatusTestContext()
+	c.query["plugin_id"] = "missing"
+	server.Get(c)
+	if c.status != 404 {
+		t.Errorf("expected 404 for an unknown plugin, got %d", c.status)
+	}
+}
+
+func TestListDuringRun(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	plugin := &Plugin{MetaInfo: &Meta{ID: "busy"}, run: func(any) (any, error) {
+		close(started)
+		<-release
+		return nil, nil
+	}}
+	plugin.setMethods(map[string]func(any) any{"b": nil, "a": nil})
+	go plugin.OnRun(nil)
+	defer close(release)
+	<-started
+
+	done := make(chan string)
+	go func() {
+		data, _ := json.Marshal([]IPlugin{plugin})
+		done <- fmt.Sprint(pluginDetail(plugin).Methods, " ", string(data))
+	}()
+	select {
+	case got := <-done:
+		if !strings.HasPrefix(got, "[a b] ") || !strings.Contains(got, `"state":"running"`) || !strings.Contains(got, `"meta":{"id":"busy"`) {
+			t.Errorf("unexpected listing %s", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the plugin to be listed while it runs")
+	}
+}
@@ -1,9 +1,10 @@
 package goplugify
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
 	"path"
@@ -32,38 +33,46 @@ type Loader interface {
 	Name() LoaderType
 }
 
-type NativePluginHTTPLoader struct{}
+type NativePluginHTTPLoader struct {
+	// MaxSize caps the size of an uploaded .so, DefaultMaxNativePluginSize when zero.
+	MaxSize int64
+}
 
 func (l *NativePluginHTTPLoader) Name() LoaderType {
 	return LoaderTypeNativePluginHTTP
 }
 
+func (l *NativePluginHTTPLoader) MaxArtifactSize() int64 {
+	return maxSizeOr(l.MaxSize, DefaultMaxNativePluginSize)
+}
+
 func (l *NativePluginHTTPLoader) Load(meta *Meta, src any) (IPlugin, error) {
 	httpContext, ok := src.(HttpContext)
 	if !ok {
 		return nil, ErrInvalidLoaderSource
 	}
 
-	pluginso, err := getPluginContent(httpContext)
+	content, err := openPluginContent(httpContext, l.MaxArtifactSize())
 	if err != nil {
 		return nil, err
 	}
+	defer content.Close()
 
-	return loadNativePluginOfContent(meta, pluginso)
-}
-
-func loadNativePluginOfContent(meta *Meta, pluginso []byte) (IPlugin, error) {
-	tmpfile, err := os.CreateTemp("", fmt.Sprintf("plugin_%d_*.so", time.Now().UnixNano()))
+	plugin, err := loadNativePlugin(meta, content, l.MaxArtifactSize())
 	if err != nil {
 		return nil, err
 	}
-	defer os.Remove(tmpfile.Name())
+	return withAssetsBundle(withVerifiedHash(plugin, httpContext), httpContext, l.MaxArtifactSize())
+}
 
-	if _, err := io.Copy(tmpfile, bytes.NewBuffer(pluginso)); err != nil {
+func loadNativePlugin(meta *Meta, content io.Reader, limit int64) (IPlugin, error) {
+	pluginPath, contentHash, err := spoolArtifact(content, limit, nativePluginTempPattern())
+	if err != nil {
 		return nil, err
 	}
+	defer os.Remove(pluginPath)
 
-	openPlugin, err := plugin.Open(tmpfile.Name())
+	openPlugin, err := plugin.Open(pluginPath)
 	if err != nil {
 		return nil, err
 	}
@@ -75,57 +84,54 @@ func loadNativePluginOfContent(meta *Meta, pluginso []byte) (IPlugin, error) {
 
 	plugin := &Plugin{
 		MetaInfo:    meta,
+		ContentHash: contentHash,
 		run:         exports.Run,
 		load:        exports.Load,
-		methods:     exports.Methods(),
 		destroy:     exports.Destroy,
+		health:      healthOf(exports),
+		State:       PluginStateIdle,
 		InstallTime: time.Now(),
 	}
+	plugin.setMethods(exports.Methods())
+	plugin.setAssets(assetsOf(exports))
 
 	return plugin, nil
 }
 
-func getPluginContent(c HttpContext) ([]byte, error) {
-	var fileContent []byte
-
-	ct := c.GetHeader("Content-Type")
-	if !strings.Contains(ct, "multipart/form-data") {
-		fileContent, _ = io.ReadAll(c.Body())
-		return fileContent, nil
-	}
-
-	file, err := c.FormFile("file")
-	if err != nil {
-		body, _ := io.ReadAll(c.Body())
-		return nil, fmt.Errorf("file error: %v raw ct: %s, body length: %d", err, ct, len(body))
-	}
-	f, err := file.Open()
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	fileContent, err = io.ReadAll(f)
-	if err != nil {
-		return nil, fmt.Errorf("read file error: %v", err)
-	}
-
-	return fileContent, nil
+type YaegiHTTPLoader struct {
+	// MaxSize caps the size of an uploaded script, DefaultMaxScriptSize when zero.
+	MaxSize int64
 }
 
-type YaegiHTTPLoader struct{}
-
 func (l *YaegiHTTPLoader) Name() LoaderType {
 	return LoaderTypeYaegiHTTP
 }
 
+func (l *YaegiHTTPLoader) MaxArtifactSize() int64 {
+	return maxSizeOr(l.MaxSize, DefaultMaxScriptSize)
+}
+
 func (l *YaegiHTTPLoader) Load(meta *Meta, src any) (IPlugin, error) {
 	httpContext, ok := src.(HttpContext)
 	if !ok {
 		return nil, ErrInvalidLoaderSource
 	}
 
-	scriptContent, err := getPluginContent(httpContext)
+	content, err := openPluginContent(httpContext, l.MaxArtifactSize())
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	plugin, err := loadYaegiPlugin(meta, content, l.MaxArtifactSize())
+	if err != nil {
+		return nil, err
+	}
+	return withAssetsBundle(withVerifiedHash(plugin, httpContext), httpContext, l.MaxArtifactSize())
+}
+
+func loadYaegiPlugin(meta *Meta, content io.Reader, limit int64) (IPlugin, error) {
+	scriptContent, contentHash, err := readArtifact(content, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -133,7 +139,8 @@ func (l *YaegiHTTPLoader) Load(meta *Meta, src any) (IPlugin, error) {
 	plugin := &YaegiPlugin{
 		Plugin: &Plugin{
 			MetaInfo:    meta,
-			methods:     map[string]func(any) any{},
+			ContentHash: contentHash,
+			State:       PluginStateIdle,
 			InstallTime: time.Now(),
 		},
 		scriptContent: scriptContent,
@@ -164,6 +171,9 @@ func (p *YaegiPlugin) OnInit(plugDepencies *PluginComponents) error {
 	p.symbols[defPkgPath] = make(map[string]reflect.Value)
 	p.symbols[defPkgPath]["Util"] = reflect.ValueOf(plugDepencies.Util)
 	p.symbols[defPkgPath]["Logger"] = reflect.ValueOf(NewLoggerWrapper(plugDepencies.Logger))
+	p.symbols[defPkgPath]["Emitter"] = reflect.ValueOf((*Emitter)(nil))
+	p.symbols[defPkgPath]["RunRequest"] = reflect.ValueOf((*RunRequest)(nil))
+	p.symbols[defPkgPath]["Response"] = reflect.ValueOf((*Response)(nil))
 
 	for _, comp := range plugDepencies.Components {
 		plugDepencies.Logger.Info("Injecting component into plugin %s, component %s", p.Meta().ID, toTitle(comp.Name()))
@@ -198,14 +208,14 @@ func (p *YaegiPlugin) OnInit(plugDepencies *PluginComponents) error {
 		return err
 	}
 	p.run = func(a any) (any, error) {
-		return runFn.Interface().(func(map[string]any) (any, error))(map[string]any{"input": a})
+		return runFn.Interface().(func(map[string]any) (any, error))(runInputMap(a))
 	}
 
 	methodsFn, err := i.Eval(packageName + "Methods")
 	if err != nil {
 		return err
 	}
-	p.methods = methodsFn.Interface().(func() map[string]func(any) any)()
+	p.setMethods(methodsFn.Interface().(func() map[string]func(any) any)())
 
 	destroyFn, err := i.Eval(packageName + "Destroy")
 	if err != nil {
@@ -215,6 +225,22 @@ func (p *YaegiPlugin) OnInit(plugDepencies *PluginComponents) error {
 		return destroyFn.Interface().(func(map[string]any) error)(map[string]any{"input": a})
 	}
 
+	// Health is optional.
+	if healthFn, err := i.Eval(packageName + "Health"); err == nil {
+		if fn, ok := healthFn.Interface().(func(context.Context) error); ok {
+			p.setHealthCheck(fn)
+		}
+	}
+
+	// Assets is optional, a bundle uploaded with the script takes precedence.
+	if p.Assets() == nil {
+		if assetsFn, err := i.Eval(packageName + "Assets"); err == nil {
+			if fn, ok := assetsFn.Interface().(func() fs.FS); ok {
+				p.setAssets(fn())
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -326,72 +352,73 @@ func GetPkgPathOfType(t reflect.Type) string {
 	return t.PkgPath()
 }
 
-type NativePluginFileLoader struct{}
+type NativePluginFileLoader struct {
+	// MaxSize caps the size of a fetched .so, DefaultMaxNativePluginSize when zero.
+	MaxSize int64
+}
 
 func (l *NativePluginFileLoader) Name() LoaderType {
 	return LoaderTypeNativePluginFile
 }
 
+func (l *NativePluginFileLoader) MaxArtifactSize() int64 {
+	return maxSizeOr(l.MaxSize, DefaultMaxNativePluginSize)
+}
+
 func (l *NativePluginFileLoader) Load(meta *Meta, src any) (IPlugin, error) {
 	filePath, ok := src.(string)
 	if !ok {
 		return nil, ErrInvalidLoaderSource
 	}
 
-	pluginso, err := getFile(filePath)
+	content, err := openFile(filePath, l.MaxArtifactSize())
 	if err != nil {
 		return nil, err
 	}
+	defer content.Close()
 
-	return loadNativePluginOfContent(meta, pluginso)
-}
-
-func getFile(url string) ([]byte, error) {
-	if strings.HasPrefix(url, "file://") {
-		filePath := strings.TrimPrefix(url, "file://")
-		return os.ReadFile(filePath)
-	}
-	return httpGet(url)
+	return loadNativePlugin(meta, content, l.MaxArtifactSize())
 }
 
-func httpGet(url string) ([]byte, error) {
+func httpGet(url string, limit int64) (io.ReadCloser, error) {
 	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
 		resp, err := http.DefaultClient.Get(url)
 		if err != nil {
 			return nil, err
 		}
-		defer resp.Body.Close()
-		return io.ReadAll(resp.Body)
+		if limit > 0 && resp.ContentLength > limit {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%w: %d bytes exceeds %d", ErrArtifactTooLarge, resp.ContentLength, limit)
+		}
+		return resp.Body, nil
 	}
 	return nil, fmt.Errorf("unsupported URL scheme")
 }
 
-type YaegiFileLoader struct{}
+type YaegiFileLoader struct {
+	// MaxSize caps the size of a fetched script, DefaultMaxScriptSize when zero.
+	MaxSize int64
+}
 
 func (l *YaegiFileLoader) Name() LoaderType {
 	return LoaderTypeYaegiFile
 }
 
+func (l *YaegiFileLoader) MaxArtifactSize() int64 {
+	return maxSizeOr(l.MaxSize, DefaultMaxScriptSize)
+}
+
 func (l *YaegiFileLoader) Load(meta *Meta, src any) (IPlugin, error) {
 	filePath, ok := src.(string)
 	if !ok {
 		return nil, ErrInvalidLoaderSource
 	}
 
-	scriptContent, err := getFile(filePath)
+	content, err := openFile(filePath, l.MaxArtifactSize())
 	if err != nil {
 		return nil, err
 	}
+	defer content.Close()
 
-	plugin := &YaegiPlugin{
-		Plugin: &Plugin{
-			MetaInfo:    meta,
-			methods:     map[string]func(any) any{},
-			InstallTime: time.Now(),
-		},
-		scriptContent: scriptContent,
-		symbols:       make(map[string]map[string]reflect.Value),
-	}
-
-	return plugin, nil
+	return loadYaegiPlugin(meta, content, l.MaxArtifactSize())
 }
@@ -5,8 +5,6 @@ import (
 	"log"
 )
 
-var logger Logger
-
 type Logger interface {
 	WarnCtx(ctx context.Context, format string, args ...any)
 	ErrorCtx(ctx context.Context, format string, args ...any)
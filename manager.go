@@ -3,24 +3,31 @@ package goplugify
 import (
 	"context"
 	"fmt"
+	"sync"
 )
 
 func InitPluginManagers(serviceName string, components ...Component) PluginManagers {
+	if serviceName == "" {
+		serviceName = "default"
+	}
+	managers := make(PluginManagers)
+	managers[serviceName] = NewPluginManager(serviceName, components...)
+	return managers
+}
+
+// NewPluginManager creates the manager of a service with its own components and the
+// default loaders.
+func NewPluginManager(serviceName string, components ...Component) *PluginManager {
 	extendCompones := make(map[string]Component)
+	// Each manager logs to the logger component of its service.
+	var logger Logger = &DefaultLogger{}
 	for _, c := range components {
 		extendCompones[c.Name()] = c
-		if _, isLogger := c.Service().(Logger); isLogger {
-			logger = c.Service().(Logger)
+		if l, isLogger := c.Service().(Logger); isLogger {
+			logger = l
 		}
 	}
-	if serviceName == "" {
-		serviceName = "default"
-	}
-	if logger == nil {
-		logger = &DefaultLogger{}
-	}
-	managers := make(PluginManagers)
-	managers[serviceName] = &PluginManager{
+	manager := &PluginManager{
 		plugins: &Plugins{
 			plugins: make(map[string]IPlugin),
 		},
@@ -29,13 +36,17 @@ func InitPluginManagers(serviceName string, components ...Component) PluginManag
 			Util:       new(Util),
 			Components: extendCompones,
 		},
-		loaders: make(map[LoaderType]Loader),
+		loaders:     make(map[LoaderType]Loader),
+		scheduler:   &scheduler{logger: logger},
+		health:      new(healthMonitor),
+		previous:    make(map[string]PluginFunc),
+		serviceName: serviceName,
 	}
-	managers[serviceName].AddLoader(new(NativePluginHTTPLoader))
-	managers[serviceName].AddLoader(new(YaegiHTTPLoader))
-	managers[serviceName].AddLoader(new(NativePluginFileLoader))
-	managers[serviceName].AddLoader(new(YaegiFileLoader))
-	return managers
+	manager.AddLoader(new(NativePluginHTTPLoader))
+	manager.AddLoader(new(YaegiHTTPLoader))
+	manager.AddLoader(new(NativePluginFileLoader))
+	manager.AddLoader(new(YaegiFileLoader))
+	return manager
 }
 
 type Manager interface {
@@ -50,10 +61,32 @@ type Manager interface {
 	Components() *PluginComponents
 }
 
+// LoaderLister is implemented by managers that list their loaders.
+type LoaderLister interface {
+	Loaders() []Loader
+}
+
+// Applier is implemented by managers that apply batches of changes as a whole.
+type Applier interface {
+	Apply(ctx context.Context, changes []Change) ([]IPlugin, error)
+}
+
+// Rollbacker is implemented by managers that keep the previous version of their
+// plugins to restore it.
+type Rollbacker interface {
+	Rollback(ctx context.Context, pluginID string) (IPlugin, error)
+}
+
 type PluginManager struct {
 	plugins    *Plugins
 	components *PluginComponents
 	loaders    map[LoaderType]Loader
+	scheduler  *scheduler
+	health     *healthMonitor
+	// previous holds the version each upgraded plugin replaced, for Rollback.
+	previous map[string]PluginFunc
+	// changeLock serializes loads, unloads and batches.
+	changeLock sync.Mutex
 
 	serviceName string
 }
@@ -66,51 +99,157 @@ func (manager *PluginManager) AddLoader(loader Loader) {
 	manager.loaders[loader.Name()] = loader
 }
 
+func (manager *PluginManager) Loaders() []Loader {
+	loaders := make([]Loader, 0, len(manager.loaders))
+	for _, loader := range manager.loaders {
+		loaders = append(loaders, loader)
+	}
+	return loaders
+}
+
+// MaxArtifactSize returns the largest artifact any of the manager's loaders accepts,
+// or 0 when at least one of them is unbounded or the manager does not list them.
+func MaxArtifactSize(manager Manager) int64 {
+	lister, ok := manager.(LoaderLister)
+	if !ok {
+		return 0
+	}
+	var max int64
+	for _, loader := range lister.Loaders() {
+		limited, ok := loader.(SizeLimitedLoader)
+		if !ok {
+			return 0
+		}
+		if size := limited.MaxArtifactSize(); size > max {
+			max = size
+		}
+	}
+	return max
+}
+
 func (manager *PluginManager) AddPlugin(plugin IPlugin) {
 	manager.plugins.Add(plugin)
 }
 
 func (manager *PluginManager) UnloadPlugin(ctx context.Context, pluginID string) error {
+	manager.changeLock.Lock()
+	defer manager.changeLock.Unlock()
+
 	plugin, ok := manager.plugins.Get(pluginID)
 	if !ok {
-		return fmt.Errorf("plugin %s not found", pluginID)
+		return WrapError(CodeNotFound, "unload", pluginID, ErrPluginNotFound)
 	}
+	manager.unwatch(pluginID)
 	err := plugin.OnDestroy(ctx)
 	if err != nil {
-		return err
+		manager.watch(plugin)
+		return WrapError(CodeDestroyFailed, "unload", pluginID, err)
 	}
 	manager.plugins.Remove(pluginID)
+	delete(manager.previous, pluginID)
 	return nil
 }
 
-func (manager *PluginManager) LoadPlugin(tx context.Context, meta *Meta, src any) (IPlugin, error) {
+// Rollback restores the version pluginID had before its last upgrade. The version
+// rolled back from becomes the previous one, so a second rollback undoes the first.
+func (manager *PluginManager) Rollback(ctx context.Context, pluginID string) (IPlugin, error) {
+	manager.changeLock.Lock()
+	defer manager.changeLock.Unlock()
 
+	plugin, ok := manager.plugins.Get(pluginID)
+	if !ok {
+		return nil, WrapError(CodeNotFound, "rollback", pluginID, ErrPluginNotFound)
+	}
+	previous, ok := manager.previous[pluginID]
+	if !ok {
+		return nil, WrapError(CodeConflict, "rollback", pluginID, ErrNoPreviousVersion)
+	}
+	manager.previous[pluginID] = plugin.ExportFunc()
+	plugin.Upgrade(previous)
+	manager.watch(plugin)
+	return plugin, nil
+}
+
+// loaderOf validates meta and returns the loader it names.
+func (manager *PluginManager) loaderOf(meta *Meta) (Loader, error) {
 	if meta == nil || meta.ID == "" || meta.Loader == "" {
-		return nil, ErrInvalidLoaderSource
+		return nil, WrapError(CodeInvalidMeta, "load", "", fmt.Errorf("%w: id and loader are required", ErrInvalidMeta))
+	}
+
+	if meta.Schedule != nil {
+		if err := meta.Schedule.Validate(); err != nil {
+			return nil, WrapError(CodeInvalidMeta, "load", meta.ID, fmt.Errorf("%w: schedule: %v", ErrInvalidMeta, err))
+		}
+	}
+
+	if err := validateHealthInterval(meta); err != nil {
+		return nil, WrapError(CodeInvalidMeta, "load", meta.ID, fmt.Errorf("%w: %v", ErrInvalidMeta, err))
+	}
+
+	if err := validateMetaSchemas(meta); err != nil {
+		return nil, WrapError(CodeInvalidMeta, "load", meta.ID, fmt.Errorf("%w: %v", ErrInvalidMeta, err))
 	}
 
 	loader, ok := manager.loaders[meta.Loader]
 	if !ok {
-		return nil, fmt.Errorf("loader %s not found", meta.Loader)
+		return nil, WrapError(CodeLoaderNotFound, "load", meta.ID, fmt.Errorf("%w: %s", ErrLoaderNotFound, meta.Loader))
 	}
+	return loader, nil
+}
 
-	loadPlug, err := loader.Load(meta, src)
+// prepare loads and initializes a plugin without making it visible.
+func (manager *PluginManager) prepare(meta *Meta, src any) (IPlugin, error) {
+	loader, err := manager.loaderOf(meta)
 	if err != nil {
 		return nil, err
 	}
 
+	loadPlug, err := loader.Load(meta, src)
+	if err != nil {
+		return nil, WrapError(CodeLoadFailed, "load", meta.ID, err)
+	}
+
 	err = loadPlug.OnInit(manager.components)
 	if err != nil {
-		return nil, err
+		return nil, WrapError(CodeInitFailed, "init", meta.ID, err)
 	}
-	existPlug, ok := manager.plugins.Get(meta.ID)
+	return loadPlug, nil
+}
+
+// watch starts the schedule and the health checks of plugin.
+func (manager *PluginManager) watch(plugin IPlugin) {
+	manager.scheduler.set(manager.serviceName, plugin)
+	manager.health.set(plugin)
+}
+
+func (manager *PluginManager) unwatch(pluginID string) {
+	manager.scheduler.stop(pluginID)
+	manager.health.stop(pluginID)
+}
+
+// swapIn adds a prepared plugin, or upgrades the loaded plugin with the same ID to it.
+func (manager *PluginManager) swapIn(loadPlug IPlugin) IPlugin {
+	existPlug, ok := manager.plugins.Get(loadPlug.Meta().ID)
 	if ok {
+		manager.previous[existPlug.Meta().ID] = existPlug.ExportFunc()
 		existPlug.Upgrade(loadPlug.ExportFunc())
-		return existPlug, nil
+		manager.watch(existPlug)
+		return existPlug
 	}
 	manager.plugins.Add(loadPlug)
+	manager.watch(loadPlug)
+	return loadPlug
+}
 
-	return loadPlug, nil
+func (manager *PluginManager) LoadPlugin(tx context.Context, meta *Meta, src any) (IPlugin, error) {
+	manager.changeLock.Lock()
+	defer manager.changeLock.Unlock()
+
+	loadPlug, err := manager.prepare(meta, src)
+	if err != nil {
+		return nil, err
+	}
+	return manager.swapIn(loadPlug), nil
 }
 
 func (manager *PluginManager) ListPlugins() []IPlugin {
@@ -120,7 +259,7 @@ func (manager *PluginManager) ListPlugins() []IPlugin {
 func (manager *PluginManager) GetPlugin(pluginID string) (IPlugin, error) {
 	plugin, ok := manager.plugins.Get(pluginID)
 	if !ok {
-		return nil, fmt.Errorf("plugin %s not found", pluginID)
+		return nil, WrapError(CodeNotFound, "get", pluginID, ErrPluginNotFound)
 	}
 	return plugin, nil
 }
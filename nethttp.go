@@ -0,0 +1,213 @@
+package goplugify
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultMultipartMemory is the part of a multipart form kept in memory by the
+// net/http adapter, the rest is spooled to temporary files.
+const DefaultMultipartMemory = 32 << 20
+
+// ServeMuxRouter adapts an *http.ServeMux to HttpRouter. Route parameters written as
+// ":name" and "*name" are translated to the "{name}" and "{name...}" wildcards.
+type ServeMuxRouter struct {
+	mux *http.ServeMux
+}
+
+func NewServeMuxRouter(mux *http.ServeMux) *ServeMuxRouter {
+	if mux == nil {
+		mux = http.NewServeMux()
+	}
+	return &ServeMuxRouter{mux: mux}
+}
+
+func (r *ServeMuxRouter) Add(method, route string, handler Handler) {
+	r.mux.HandleFunc(method+" "+serveMuxPattern(route), func(w http.ResponseWriter, req *http.Request) {
+		handler(NewNetHTTPContext(w, req))
+	})
+}
+
+func (r *ServeMuxRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mux.ServeHTTP(w, req)
+}
+
+func serveMuxPattern(route string) string {
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			segments[i] = "{" + segment[1:] + "}"
+		case strings.HasPrefix(segment, "*"):
+			segments[i] = "{" + segment[1:] + "...}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// NetHTTPContext implements HttpContext over a net/http request and response.
+type NetHTTPContext struct {
+	w   http.ResponseWriter
+	req *http.Request
+
+	wroteHeader bool
+	values      map[string]any
+	formErr     error
+	limited     *limitedBody
+}
+
+func NewNetHTTPContext(w http.ResponseWriter, req *http.Request) *NetHTTPContext {
+	return &NetHTTPContext{w: w, req: req}
+}
+
+func (c *NetHTTPContext) GetHeader(key string) string {
+	return c.req.Header.Get(key)
+}
+
+func (c *NetHTTPContext) Body() io.ReadCloser {
+	return c.req.Body
+}
+
+func (c *NetHTTPContext) FormFile(name string) (*multipart.FileHeader, error) {
+	if err := c.parseForm(); err != nil {
+		return nil, err
+	}
+	_, file, err := c.req.FormFile(name)
+	return file, err
+}
+
+// parseForm parses the form once, the spooled parts of a multipart form stay
+// within the limit set by LimitBody.
+func (c *NetHTTPContext) parseForm() error {
+	if c.req.PostForm != nil || c.formErr != nil {
+		return c.formErr
+	}
+	var err error
+	if strings.HasPrefix(c.req.Header.Get("Content-Type"), "multipart/form-data") {
+		err = c.req.ParseMultipartForm(DefaultMultipartMemory)
+	} else {
+		err = c.req.ParseForm()
+	}
+	// The multipart reader does not always wrap the error of the body, such as when
+	// the limit cuts the headers of a part.
+	if c.limited != nil && c.limited.err != nil {
+		err = c.limited.err
+	}
+	if err != nil {
+		c.formErr = bodyError(err)
+	}
+	return c.formErr
+}
+
+func (c *NetHTTPContext) formError() error {
+	return c.formErr
+}
+
+// LimitBody caps the request body to limit bytes, reading past it fails with
+// ErrArtifactTooLarge. It has no effect once the form is parsed.
+func (c *NetHTTPContext) LimitBody(limit int64) {
+	if c.req.PostForm == nil && c.formErr == nil {
+		c.limited = &limitedBody{ReadCloser: http.MaxBytesReader(c.w, c.req.Body, limit)}
+		c.req.Body = c.limited
+	}
+}
+
+// limitedBody records the error of a body read past its limit.
+type limitedBody struct {
+	io.ReadCloser
+	err error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxBytes *http.MaxBytesError
+	if errors.As(err, &maxBytes) {
+		b.err = err
+	}
+	return n, err
+}
+
+func (c *NetHTTPContext) Query(key string) string {
+	return c.req.URL.Query().Get(key)
+}
+
+// PostForm returns "" when the form cannot be parsed, the error is reported by
+// FormFile and by the routes reading form fields.
+func (c *NetHTTPContext) PostForm(key string) string {
+	if c.parseForm() != nil {
+		return ""
+	}
+	return c.req.PostForm.Get(key)
+}
+
+func (c *NetHTTPContext) Param(key string) string {
+	return c.req.PathValue(key)
+}
+
+func (c *NetHTTPContext) Request() *http.Request {
+	return c.req
+}
+
+func (c *NetHTTPContext) Method() string {
+	return c.req.Method
+}
+
+func (c *NetHTTPContext) Path() string {
+	return c.req.URL.Path
+}
+
+func (c *NetHTTPContext) RawQuery() string {
+	return c.req.URL.RawQuery
+}
+
+func (c *NetHTTPContext) JSON(code int, obj any) {
+	c.SetHeader("Content-Type", "application/json; charset=utf-8")
+	c.WriteHeader(code)
+	json.NewEncoder(c.w).Encode(obj)
+}
+
+func (c *NetHTTPContext) SetHeader(key, value string) {
+	c.w.Header().Set(key, value)
+}
+
+func (c *NetHTTPContext) WriteHeader(code int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+	c.w.WriteHeader(code)
+}
+
+func (c *NetHTTPContext) Write(data []byte) (int, error) {
+	c.wroteHeader = true
+	return c.w.Write(data)
+}
+
+func (c *NetHTTPContext) Flush() {
+	http.NewResponseController(c.w).Flush()
+}
+
+func (c *NetHTTPContext) Deadline() (time.Time, bool) { return c.req.Context().Deadline() }
+func (c *NetHTTPContext) Done() <-chan struct{}       { return c.req.Context().Done() }
+func (c *NetHTTPContext) Err() error                  { return c.req.Context().Err() }
+
+func (c *NetHTTPContext) Value(key any) any {
+	if k, ok := key.(string); ok {
+		if v, ok := c.values[k]; ok {
+			return v
+		}
+	}
+	return c.req.Context().Value(key)
+}
+
+func (c *NetHTTPContext) Set(key string, value any) {
+	if c.values == nil {
+		c.values = make(map[string]any)
+	}
+	c.values[key] = value
+}
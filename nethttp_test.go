@@ -0,0 +1,161 @@
+package goplugify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeMuxPattern(t *testing.T) {
+	tests := map[string]string{
+		"/plugin/run":                "/plugin/run",
+		"/plugins/:id":               "/plugins/{id}",
+		"/plugins/:id/methods/:name": "/plugins/{id}/methods/{name}",
+		"/api/plugin/gw/*path":       "/api/plugin/gw/{path...}",
+	}
+	for route, want := range tests {
+		if got := serveMuxPattern(route); got != want {
+			t.Errorf("%s: expected %s, got %s", route, want, got)
+		}
+	}
+}
+
+func TestServeMuxRouter(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	router := NewServeMuxRouter(nil)
+	server.RegisterRoutes(router, "/api")
+	server.RegisterRoutesV2(router, "/api/v2")
+	server.RegisterGateway(router, "/api")
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("meta", `{"id": "demo", "loader": "yaegi_http"}`)
+	fw, _ := mw.CreateFormFile("file", "demo.go")
+	fw.Write([]byte(testScript))
+	mw.Close()
+	resp, err := http.Post(ts.URL+"/api/plugin/load", mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta Meta
+	json.NewDecoder(resp.Body).Decode(&meta)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || meta.ID != "demo" {
+		t.Fatalf("unexpected load response %d %+v", resp.StatusCode, meta)
+	}
+
+	resp, err = http.Post(ts.URL+"/api/plugin/run?plugin_id=demo", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result string
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || result != "ran" {
+		t.Fatalf("unexpected run response %d %q", resp.StatusCode, result)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/v2/plugins/demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected 200 for a path parameter route, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/plugin/list?service=missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected the original routes to answer 500 by default, got %d", resp.StatusCode)
+	}
+	server.SetStatusCodes(true)
+	resp, err = http.Get(ts.URL + "/api/plugin/list?service=missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("expected 404 for an unknown service, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(ts.URL+"/api/plugin/run/stream?plugin_id=demo&format=ndjson", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "application/x-ndjson" || !strings.Contains(string(stream), `"event":"result"`) {
+		t.Errorf("unexpected stream %s: %s", resp.Header.Get("Content-Type"), stream)
+	}
+}
+
+func TestServeMuxChunkedUploadLimit(t *testing.T) {
+	manager := NewPluginManager("default")
+	manager.AddLoader(&NativePluginHTTPLoader{MaxSize: 1 << 10})
+	manager.AddLoader(&YaegiHTTPLoader{MaxSize: 1 << 10})
+	manager.AddLoader(&NativePluginFileLoader{MaxSize: 1 << 10})
+	manager.AddLoader(&YaegiFileLoader{MaxSize: 1 << 10})
+	server := InitHTTPServer(PluginManagers{"default": manager})
+	router := NewServeMuxRouter(nil)
+	server.RegisterRoutes(router, "/api")
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// A pipe has no length, the upload is sent chunked without Content-Length.
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		mw.WriteField("meta", `{"id": "big", "loader": "yaegi_http"}`)
+		fw, _ := mw.CreateFormFile("file", "big.go")
+		chunk := bytes.Repeat([]byte("/"), 64<<10)
+		for i := 0; i < 32; i++ {
+			if _, err := fw.Write(chunk); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		mw.Close()
+		pw.Close()
+	}()
+	req, _ := http.NewRequest("POST", ts.URL+"/api/plugin/load", pr)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 413 || !strings.Contains(string(data), "too large") {
+		t.Errorf("expected a chunked upload over the limit to be rejected, got %d %s", resp.StatusCode, data)
+	}
+}
+
+func TestNetHTTPContextLimitBody(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "plugin.go")
+	fw.Write([]byte("package main"))
+	mw.Close()
+
+	// The limit cuts the headers of the part, which the multipart reader reports
+	// without the error of the body.
+	req := httptest.NewRequest("POST", "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	c := NewNetHTTPContext(httptest.NewRecorder(), req)
+	c.LimitBody(80)
+	if _, err := c.FormFile("file"); !errors.Is(err, ErrArtifactTooLarge) {
+		t.Errorf("expected ErrArtifactTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package goplugify
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultNonceCapacity is the number of nonces remembered by the store of NewHMACAuth.
+var DefaultNonceCapacity = 100000
+
+// NonceStore remembers the nonces of authenticated requests to reject replays.
+type NonceStore interface {
+	// Remember records nonce until expiry and reports false when it is already
+	// recorded.
+	Remember(ctx context.Context, nonce string, expiry time.Time) (bool, error)
+}
+
+// MemoryNonceStore is a NonceStore for a single node. Once full it evicts the least
+// recently recorded nonce, capacity should exceed the requests expected within
+// the clock skew window.
+type MemoryNonceStore struct {
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+	lock     sync.Mutex
+}
+
+type nonceEntry struct {
+	nonce  string
+	expiry time.Time
+}
+
+func NewMemoryNonceStore(capacity int) *MemoryNonceStore {
+	return &MemoryNonceStore{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (s *MemoryNonceStore) Remember(ctx context.Context, nonce string, expiry time.Time) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	if elem, ok := s.entries[nonce]; ok {
+		if elem.Value.(*nonceEntry).expiry.After(now) {
+			return false, nil
+		}
+		s.order.Remove(elem)
+		delete(s.entries, nonce)
+	}
+	// Nonces are recorded in about expiry order, the expired ones at the back are
+	// dropped on the way.
+	for back := s.order.Back(); back != nil && !back.Value.(*nonceEntry).expiry.After(now); back = s.order.Back() {
+		s.order.Remove(back)
+		delete(s.entries, back.Value.(*nonceEntry).nonce)
+	}
+	if s.capacity > 0 && s.order.Len() >= s.capacity {
+		back := s.order.Back()
+		s.order.Remove(back)
+		delete(s.entries, back.Value.(*nonceEntry).nonce)
+	}
+	s.entries[nonce] = s.order.PushFront(&nonceEntry{nonce: nonce, expiry: expiry})
+	return true, nil
+}
+
+// SetNXStore is a key value store shared by the nodes, such as Redis with SET NX.
+type SetNXStore interface {
+	// SetNX sets key with a time to live unless it exists, and reports whether it
+	// was set.
+	SetNX(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// SharedNonceStore keeps the nonces in a store shared by the nodes of a deployment,
+// so that a request accepted by one node cannot be replayed on another.
+type SharedNonceStore struct {
+	Store  SetNXStore
+	Prefix string
+}
+
+func NewSharedNonceStore(store SetNXStore, prefix string) *SharedNonceStore {
+	return &SharedNonceStore{Store: store, Prefix: prefix}
+}
+
+func (s *SharedNonceStore) Remember(ctx context.Context, nonce string, expiry time.Time) (bool, error) {
+	ttl := time.Until(expiry)
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	return s.Store.SetNX(ctx, s.Prefix+nonce, ttl)
+}
@@ -0,0 +1,353 @@
+package goplugify
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// OpenAPI serves the OpenAPI 3 document of the routes registered on the server.
+func (server *HTTPServer) OpenAPI(c HttpContext) {
+	c.JSON(200, server.OpenAPIDocument())
+}
+
+// OpenAPIDocument builds an OpenAPI 3 document from the registered routes and the
+// handlers added by plugins.
+func (server *HTTPServer) OpenAPIDocument() map[string]any {
+	gen := &schemaGenerator{
+		schemas: make(map[string]any),
+		named: map[reflect.Type]string{
+			reflect.TypeOf(Meta{}):                "Meta",
+			reflect.TypeOf(Plugin{}):              "Plugin",
+			reflect.TypeOf(PluginComponentItem{}): "PluginComponentItem",
+			reflect.TypeOf(APIError{}):            "APIError",
+			reflect.TypeOf(Job{}):                 "Job",
+			reflect.TypeOf(ServiceInfo{}):         "ServiceInfo",
+			reflect.TypeOf(PluginDetail{}):        "PluginDetail",
+			reflect.TypeOf(HealthReport{}):        "HealthReport",
+		},
+	}
+	for t := range gen.named {
+		gen.define(t)
+	}
+	// Listings are pages when the client passes limit or cursor.
+	gen.schemas["PluginList"] = map[string]any{"oneOf": []any{
+		map[string]any{"type": "array", "items": schemaRef("Plugin")},
+		objectSchema(map[string]any{
+			"plugins":     map[string]any{"type": "array", "items": schemaRef("Plugin")},
+			"next_cursor": map[string]any{"type": "string"},
+		}),
+	}}
+	gen.schemas["JobList"] = map[string]any{"type": "array", "items": schemaRef("Job")}
+	gen.schemas["ServiceList"] = map[string]any{"type": "array", "items": schemaRef("ServiceInfo")}
+	gen.schemas["MetaList"] = map[string]any{"type": "array", "items": schemaRef("Meta")}
+	gen.schemas["PluginComponentItems"] = map[string]any{"type": "array", "items": schemaRef("PluginComponentItem")}
+	gen.schemas["Message"] = objectSchema(map[string]any{"message": map[string]any{"type": "string"}})
+	gen.schemas["Error"] = objectSchema(map[string]any{"error": map[string]any{"type": "string"}})
+	gen.schemas["ErrorEnvelope"] = objectSchema(map[string]any{"error": schemaRef("APIError")})
+
+	secured := false
+	paths := make(map[string]map[string]any)
+	for _, route := range server.Routes() {
+		path := openAPIPath(route.Path)
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		op := routeOperation(route)
+		if strings.HasSuffix(route.Path, "/plugin/gateway") {
+			if pluginRoutes := server.GatewayRoutes(); len(pluginRoutes) > 0 {
+				op["x-plugin-routes"] = pluginRoutes
+			}
+		}
+		paths[path][strings.ToLower(route.Method)] = op
+		secured = secured || route.Secured
+	}
+
+	// Plugin routes become real paths under every prefix the gateway is mounted on.
+	server.lock.RLock()
+	mounts := append([]string(nil), server.gatewayMounts...)
+	server.lock.RUnlock()
+	for _, mount := range mounts {
+		for _, route := range server.GatewayRoutes() {
+			if !strings.HasPrefix(route.Pattern, "/") {
+				// Reachable through the path query parameter only.
+				continue
+			}
+			path := mount + gatewayOpenAPIPath(route.Pattern)
+			if paths[path] == nil {
+				paths[path] = make(map[string]any)
+			}
+			methods := []string{route.Method}
+			if route.Method == AnyMethod {
+				methods = GatewayMethods
+			}
+			for _, method := range methods {
+				paths[path][strings.ToLower(method)] = gatewayOperation(method, mount, route)
+			}
+		}
+	}
+
+	components := map[string]any{
+		"schemas": gen.schemas,
+	}
+	if secured {
+		components["securitySchemes"] = hmacSecuritySchemes()
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "go-plugify management API",
+			"version": "1.0.0",
+		},
+		"paths":      paths,
+		"components": components,
+	}
+}
+
+var gatewayParamPattern = regexp.MustCompile(`\{([^}]*?)(\.\.\.)?\}|\*$`)
+
+// gatewayOpenAPIPath converts a gateway pattern into an OpenAPI path, a trailing "*"
+// wildcard becomes a "{*}" parameter.
+func gatewayOpenAPIPath(pattern string) string {
+	return gatewayParamPattern.ReplaceAllStringFunc(pattern, func(m string) string {
+		if m == "*" {
+			return "{*}"
+		}
+		return "{" + strings.TrimSuffix(strings.Trim(m, "{}"), "...") + "}"
+	})
+}
+
+func gatewayOperation(method, mount string, route GatewayRoute) map[string]any {
+	params := []any{}
+	for _, match := range gatewayParamPattern.FindAllStringSubmatch(route.Pattern, -1) {
+		name := match[1]
+		if match[0] == "*" {
+			name = "*"
+		}
+		params = append(params, map[string]any{
+			"name": name, "in": "path", "required": true,
+			"schema": map[string]any{"type": "string"},
+		})
+	}
+	return map[string]any{
+		"summary":     "Plugin route " + route.Pattern,
+		"operationId": strings.ToLower(method) + strings.NewReplacer("/", "_", "{", "", "}", "", ".", "", "*", "any", "-", "_").Replace(mount+route.Pattern),
+		"tags":        []string{"plugin"},
+		"parameters":  params,
+		"responses": map[string]any{
+			"default": map[string]any{"description": "Plugin defined response"},
+		},
+	}
+}
+
+var routeParamPattern = regexp.MustCompile(`[:*]([A-Za-z_][A-Za-z0-9_]*)`)
+
+// openAPIPath converts router parameters such as ":id" into "{id}".
+func openAPIPath(path string) string {
+	return routeParamPattern.ReplaceAllString(path, "{$1}")
+}
+
+func routeOperation(route Route) map[string]any {
+	params := []any{}
+	for _, match := range routeParamPattern.FindAllStringSubmatch(route.Path, -1) {
+		params = append(params, map[string]any{
+			"name": match[1], "in": "path", "required": true,
+			"schema": map[string]any{"type": "string"},
+		})
+	}
+	for _, name := range route.Query {
+		params = append(params, map[string]any{
+			"name": name, "in": "query", "required": true,
+			"schema": map[string]any{"type": "string"},
+		})
+	}
+	for _, name := range route.Params {
+		params = append(params, map[string]any{
+			"name": name, "in": "query",
+			"schema": map[string]any{"type": "string"},
+		})
+	}
+	if route.Service {
+		params = append(params, map[string]any{
+			"name": "service", "in": "query",
+			"description": "plugin manager service, default when empty",
+			"schema":      map[string]any{"type": "string"},
+		})
+	}
+
+	errorSchema := "Error"
+	if route.ErrorFormat == ErrorFormatEnvelope {
+		errorSchema = "ErrorEnvelope"
+	}
+	success := map[string]any{"description": "OK"}
+	if route.Response != "" {
+		success["content"] = jsonContent(schemaRef(route.Response))
+	} else {
+		success["content"] = jsonContent(map[string]any{})
+	}
+
+	op := map[string]any{
+		"summary":     route.Summary,
+		"operationId": operationID(route),
+		"parameters":  params,
+		"responses": map[string]any{
+			"200":     success,
+			"default": map[string]any{"description": "Error", "content": jsonContent(schemaRef(errorSchema))},
+		},
+	}
+
+	switch route.Body {
+	case RouteBodyJSON:
+		op["requestBody"] = map[string]any{"content": jsonContent(map[string]any{})}
+	case RouteBodyMultipart:
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{
+				"multipart/form-data": map[string]any{
+					"schema": map[string]any{
+						"type":     "object",
+						"required": []string{"meta", "file"},
+						"properties": map[string]any{
+							"meta": map[string]any{"type": "string", "description": "JSON encoded Meta"},
+							"file": map[string]any{"type": "string", "format": "binary"},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	if route.Secured {
+		requirement := map[string]any{
+			"appid": []string{}, "timestamp": []string{}, "nonce": []string{}, "signature": []string{},
+		}
+		if route.ContentHash {
+			requirement["contentHash"] = []string{}
+		}
+		op["security"] = []any{requirement}
+		if len(route.Permissions) > 0 {
+			op["x-permissions"] = route.Permissions
+		}
+	}
+	return op
+}
+
+func operationID(route Route) string {
+	replacer := strings.NewReplacer("/", "_", ":", "", "*", "", ".", "_", "-", "_")
+	return strings.ToLower(route.Method) + strings.TrimRight(replacer.Replace(route.Path), "_")
+}
+
+func hmacSecuritySchemes() map[string]any {
+	header := func(name, description string) map[string]any {
+		return map[string]any{"type": "apiKey", "in": "header", "name": name, "description": description}
+	}
+	return map[string]any{
+		"appid":     header("X-Go-Plugify-Appid", "application ID"),
+		"timestamp": header("X-Go-Plugify-Timestamp", "unix timestamp in seconds"),
+		"nonce":     header("X-Go-Plugify-Nonce", "random value unique per request"),
+		"signature": header("X-Go-Plugify-Signature", "hex HMAC-SHA256 of the canonical string, see HMACAuthSignParams"),
+		"signVersion": header("X-Go-Plugify-Sign-Version",
+			"2 to also sign the method, the path and the sorted query, see HMACAuthSignParams"),
+		"contentHash": header("X-Go-Plugify-Content-Hash",
+			"hex SHA-256 of the uploaded artifact, part of the signature when present and required by the routes loading plugins"),
+		"metaHash":   header("X-Go-Plugify-Meta-Hash", "hex SHA-256 of the meta form field, required along with contentHash"),
+		"assetsHash": header("X-Go-Plugify-Assets-Hash", "hex SHA-256 of the assets form field, required along with contentHash"),
+	}
+}
+
+func schemaRef(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+func objectSchema(properties map[string]any) map[string]any {
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+// schemaGenerator derives JSON schemas from Go types using their json tags.
+type schemaGenerator struct {
+	schemas map[string]any
+	named   map[reflect.Type]string
+}
+
+func (g *schemaGenerator) define(t reflect.Type) {
+	name := g.named[t]
+	if _, ok := g.schemas[name]; ok {
+		return
+	}
+	g.schemas[name] = g.structSchema(t)
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+func (g *schemaGenerator) schemaOf(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if name, ok := g.named[t]; ok {
+		return schemaRef(name)
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		return g.structSchema(t)
+	}
+	return map[string]any{}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		// Embedded structs are inlined the way encoding/json does.
+		if name == "" && f.Anonymous && f.Type.Kind() == reflect.Struct {
+			for k, v := range g.structSchema(f.Type)["properties"].(map[string]any) {
+				properties[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = g.schemaOf(f.Type)
+	}
+	return objectSchema(properties)
+}
@@ -0,0 +1,93 @@
+package goplugify
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type testRouter struct {
+	routes map[string]Handler
+}
+
+func newTestRouter() *testRouter {
+	return &testRouter{routes: map[string]Handler{}}
+}
+
+func (r *testRouter) Add(method, route string, handler Handler) {
+	r.routes[method+" "+route] = handler
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	router := newTestRouter()
+	server.RegisterRoutes(WithAuthHttpRouter(router, NewHMACAuth("app", "secret")), "/api")
+	server.RegisterRoutesV2(router, "/api/v2")
+	server.AddHandler("/hello", func(c HttpContext) {})
+	server.RegisterGateway(router, "/api")
+	if err := server.AddRoute("GET", "/orders/{id}", func(c HttpContext) {}); err != nil {
+		t.Fatalf("add route: %v", err)
+	}
+
+	if _, ok := router.routes["GET /api/openapi.json"]; !ok {
+		t.Fatalf("openapi route not registered: %v", router.routes)
+	}
+
+	c := newTestContext()
+	server.OpenAPI(c)
+	data, err := json.Marshal(c.resp)
+	if err != nil {
+		t.Fatalf("marshal document: %v", err)
+	}
+	var doc struct {
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas         map[string]any `json:"schemas"`
+			SecuritySchemes map[string]any `json:"securitySchemes"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("unmarshal document: %v", err)
+	}
+
+	for _, name := range []string{"Meta", "Plugin", "PluginComponentItem"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("missing schema %s", name)
+		}
+	}
+	if _, ok := doc.Components.SecuritySchemes["signature"]; !ok {
+		t.Errorf("missing HMAC security scheme")
+	}
+	if _, ok := doc.Paths["/api/plugin/run"]["post"]["security"]; !ok {
+		t.Errorf("legacy routes should require the HMAC headers")
+	}
+	if _, ok := doc.Paths["/api/v2/plugins/{id}/methods/{name}"]["post"]; !ok {
+		t.Errorf("missing v2 method route, got paths %v", doc.Paths)
+	}
+	if _, ok := doc.Paths["/api/v2/plugins/{id}"]["get"]["security"]; ok {
+		t.Errorf("unauthenticated routes should not require the HMAC headers")
+	}
+	if !strings.Contains(string(data), `"x-plugin-routes":[{"method":"*","pattern":"/hello"},{"method":"GET","pattern":"/orders/{id}"}]`) {
+		t.Errorf("plugin routes missing from gateway operation")
+	}
+	if _, ok := doc.Paths["/api/plugin/gw/orders/{id}"]["get"]; !ok {
+		t.Errorf("mounted plugin route missing, got paths %v", doc.Paths)
+	}
+}
+
+func TestRoutesRegisteredTwice(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	server.RegisterRoutes(WithAuthHttpRouter(newTestRouter(), NewHMACAuth("app", "secret")), "/api")
+	count := len(server.Routes())
+	server.RegisterRoutes(newTestRouter(), "/api")
+
+	routes := server.Routes()
+	if len(routes) != count {
+		t.Fatalf("expected the routes to be documented once, got %d then %d", count, len(routes))
+	}
+	for _, route := range routes {
+		if route.Secured {
+			t.Errorf("expected %s %s to be replaced by its last registration", route.Method, route.Path)
+		}
+	}
+}
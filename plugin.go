@@ -1,7 +1,11 @@
 package goplugify
 
 import (
+	"context"
+	"encoding/json"
+	"io/fs"
 	"os"
+	"sort"
 	"sync"
 	"time"
 )
@@ -31,6 +35,17 @@ type Meta struct {
 	Version     string               `json:"version"`
 	Loader      LoaderType           `json:"loader"`
 	Components  PluginComponentItems `json:"components"`
+	Tags        []string             `json:"tags,omitempty"`
+	Schedule    *Schedule            `json:"schedule,omitempty"`
+	// Critical plugins make the node unavailable in the health report while their
+	// health check fails.
+	Critical bool `json:"critical,omitempty"`
+	// HealthInterval is the period of the health check, a Go duration,
+	// DefaultHealthInterval when empty.
+	HealthInterval string `json:"health_interval,omitempty"`
+	// InputSchema is the JSON Schema of the Run input, the JSON request body.
+	InputSchema json.RawMessage         `json:"input_schema,omitempty"`
+	Methods     map[string]MethodSchema `json:"methods,omitempty"`
 }
 
 type PluginComponentItems []*PluginComponentItem
@@ -49,33 +64,187 @@ type PluginComponentItem struct {
 	Name    string `json:"name"`
 }
 
+type PluginState string
+
+const (
+	PluginStateIdle    PluginState = "idle"
+	PluginStateRunning PluginState = "running"
+)
+
 type Plugin struct {
-	MetaInfo *Meta `json:"meta"`
+	MetaInfo *Meta       `json:"meta"`
+	State    PluginState `json:"state"`
 
 	InstallTime time.Time `json:"install_time"`
 	UpgradeTime time.Time `json:"upgrade_time"`
 	RunTime     time.Time `json:"latest_run_time"`
 	RunTimes    int       `json:"run_times"`
 	Host        string    `json:"run_host"`
+	ContentHash string    `json:"content_hash,omitempty"`
+	// VerifiedHash is the signed content hash the artifact was checked against,
+	// empty when the upload was not signed.
+	VerifiedHash string `json:"verified_hash,omitempty"`
+	// NextRunTime is the next scheduled run, set while the plugin has a schedule.
+	NextRunTime *time.Time `json:"next_run_time,omitempty"`
+	// HasUI is set when the plugin ships assets served under /plugin/ui/{id}/.
+	HasUI bool `json:"has_ui,omitempty"`
+	// Health is the result of the last health check, nil until one returns.
+	Health *HealthStatus `json:"health,omitempty"`
 
-	run     func(any) (any, error)   `json:"-"`
-	load    func(any) error          `json:"-"`
-	methods map[string]func(any) any `json:"-"`
-	destroy func(any) error          `json:"-"`
+	run     func(any) (any, error)      `json:"-"`
+	load    func(any) error             `json:"-"`
+	methods map[string]func(any) any    `json:"-"`
+	destroy func(any) error             `json:"-"`
+	assets  fs.FS                       `json:"-"`
+	health  func(context.Context) error `json:"-"`
+
+	// methodNames are the sorted names of methods, kept apart so that they can be
+	// listed while a run holds lock.
+	methodNames []string `json:"-"`
 
 	lock sync.RWMutex `json:"-"`
+	// stateLock guards MetaInfo, the state, the run statistics, NextRunTime, the
+	// health check, the assets and the method names, which change while a run
+	// holds lock.
+	stateLock sync.RWMutex `json:"-"`
+}
+
+// MarshalJSON encodes the meta and the stats of the plugin, read under stateLock.
+func (p *Plugin) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Meta *Meta `json:"meta"`
+		PluginStats
+	}{p.Meta(), p.Stats()})
 }
 
 func (p *Plugin) Meta() *Meta {
+	p.stateLock.RLock()
+	defer p.stateLock.RUnlock()
 	return p.MetaInfo
 }
 
+// Assets returns the UI assets of the current version, nil when it has none.
+func (p *Plugin) Assets() fs.FS {
+	p.stateLock.RLock()
+	defer p.stateLock.RUnlock()
+	return p.assets
+}
+
+func (p *Plugin) setAssets(assets fs.FS) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	p.assets = assets
+	p.HasUI = assets != nil
+}
+
+func (p *Plugin) setVerifiedHash(hash string) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	p.VerifiedHash = hash
+}
+
+// PluginStats is the runtime state of a plugin, see StatsOf.
+type PluginStats struct {
+	State        PluginState   `json:"state"`
+	InstallTime  time.Time     `json:"install_time"`
+	UpgradeTime  time.Time     `json:"upgrade_time"`
+	RunTime      time.Time     `json:"latest_run_time"`
+	RunTimes     int           `json:"run_times"`
+	Host         string        `json:"run_host"`
+	ContentHash  string        `json:"content_hash,omitempty"`
+	VerifiedHash string        `json:"verified_hash,omitempty"`
+	NextRunTime  *time.Time    `json:"next_run_time,omitempty"`
+	HasUI        bool          `json:"has_ui,omitempty"`
+	Health       *HealthStatus `json:"health,omitempty"`
+}
+
+func (p *Plugin) Stats() PluginStats {
+	p.stateLock.RLock()
+	defer p.stateLock.RUnlock()
+	state := p.State
+	if state == "" {
+		state = PluginStateIdle
+	}
+	return PluginStats{
+		State:        state,
+		InstallTime:  p.InstallTime,
+		UpgradeTime:  p.UpgradeTime,
+		RunTime:      p.RunTime,
+		RunTimes:     p.RunTimes,
+		Host:         p.Host,
+		ContentHash:  p.ContentHash,
+		VerifiedHash: p.VerifiedHash,
+		NextRunTime:  p.NextRunTime,
+		HasUI:        p.HasUI,
+		Health:       p.Health,
+	}
+}
+
+// StatsOf returns the runtime state of plugin, zero for implementations other than
+// Plugin.
+func StatsOf(plugin IPlugin) PluginStats {
+	if sp, ok := plugin.(interface{ Stats() PluginStats }); ok {
+		return sp.Stats()
+	}
+	return PluginStats{State: PluginStateIdle}
+}
+
+// MethodNames returns the sorted names of the exported methods.
+func (p *Plugin) MethodNames() []string {
+	p.stateLock.RLock()
+	defer p.stateLock.RUnlock()
+	return append([]string{}, p.methodNames...)
+}
+
+// setMethods sets the exported methods, the caller holds lock unless the plugin is
+// not shared yet.
+func (p *Plugin) setMethods(methods map[string]func(any) any) {
+	names := make([]string, 0, len(methods))
+	for name := range methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	p.methods = methods
+	p.stateLock.Lock()
+	p.methodNames = names
+	p.stateLock.Unlock()
+}
+
+func (p *Plugin) healthCheck() func(context.Context) error {
+	p.stateLock.RLock()
+	defer p.stateLock.RUnlock()
+	return p.health
+}
+
+func (p *Plugin) setHealthCheck(check func(context.Context) error) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	p.health = check
+}
+
+func (p *Plugin) setHealth(status *HealthStatus) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	p.Health = status
+}
+
+func (p *Plugin) setNextRunTime(next *time.Time) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	p.NextRunTime = next
+}
+
 func (p *Plugin) ExportFunc() PluginFunc {
 	return &exportedPluginFunc{
-		run:     p.run,
-		load:    p.load,
-		methods: p.methods,
-		destroy: p.destroy,
+		run:          p.run,
+		load:         p.load,
+		methods:      p.methods,
+		destroy:      p.destroy,
+		contentHash:  p.ContentHash,
+		verifiedHash: p.VerifiedHash,
+		meta:         p.Meta(),
+		assets:       p.Assets(),
+		health:       p.healthCheck(),
 	}
 }
 
@@ -84,6 +253,12 @@ type exportedPluginFunc struct {
 	load    func(any) error
 	methods map[string]func(any) any
 	destroy func(any) error
+
+	contentHash  string
+	verifiedHash string
+	meta         *Meta
+	assets       fs.FS
+	health       func(context.Context) error
 }
 
 func (e *exportedPluginFunc) Run(req any) (any, error) {
@@ -116,10 +291,25 @@ func (p *Plugin) Upgrade(newPlugin PluginFunc) {
 
 	p.run = newPlugin.Run
 	p.load = newPlugin.Load
-	p.methods = newPlugin.Methods()
+	p.setMethods(newPlugin.Methods())
 	p.destroy = newPlugin.Destroy
+	if exported, ok := newPlugin.(*exportedPluginFunc); ok {
+		p.setAssets(exported.assets)
+		p.setHealthCheck(exported.health)
+		p.stateLock.Lock()
+		p.ContentHash = exported.contentHash
+		p.VerifiedHash = exported.verifiedHash
+		if exported.meta != nil {
+			p.MetaInfo = exported.meta
+		}
+		p.stateLock.Unlock()
+	} else {
+		p.setHealthCheck(healthOf(newPlugin))
+	}
 
+	p.stateLock.Lock()
 	p.UpgradeTime = time.Now()
+	p.stateLock.Unlock()
 }
 
 func (p *Plugin) OnInit(plugDepencies *PluginComponents) error {
@@ -146,9 +336,18 @@ func (p *Plugin) OnRun(req any) (any, error) {
 	}
 	p.lock.Lock()
 	defer p.lock.Unlock()
+	host, _ := os.Hostname()
+	p.stateLock.Lock()
+	p.State = PluginStateRunning
 	p.RunTime = time.Now()
 	p.RunTimes++
-	p.Host, _ = os.Hostname()
+	p.Host = host
+	p.stateLock.Unlock()
+	defer func() {
+		p.stateLock.Lock()
+		p.State = PluginStateIdle
+		p.stateLock.Unlock()
+	}()
 	return p.run(req)
 }
 
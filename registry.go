@@ -0,0 +1,121 @@
+package goplugify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var ErrServiceNotFound = NewCodeError(CodeNotFound, "service not found")
+
+// Registry holds the plugin manager of every service, services can be added and
+// removed while the HTTP server is running.
+type Registry struct {
+	managers map[string]Manager
+	lock     sync.RWMutex
+}
+
+func NewRegistry(managers PluginManagers) *Registry {
+	r := &Registry{managers: make(map[string]Manager)}
+	for name, manager := range managers {
+		r.managers[name] = manager
+	}
+	return r
+}
+
+// Add registers manager as service name, which must not be registered yet.
+func (r *Registry) Add(name string, manager Manager) error {
+	if name == "" || manager == nil {
+		return NewCodeError(CodeInvalidRequest, "service name and manager are required")
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.managers[name]; ok {
+		return NewCodeError(CodeConflict, fmt.Sprintf("service %s already exists", name))
+	}
+	r.managers[name] = manager
+	return nil
+}
+
+// Remove unloads every plugin of service name and removes it. The service is kept
+// when a plugin fails to unload.
+func (r *Registry) Remove(ctx context.Context, name string) error {
+	manager, ok := r.Get(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrServiceNotFound, name)
+	}
+	var errs []error
+	for _, plugin := range manager.ListPlugins() {
+		if err := manager.UnloadPlugin(ctx, plugin.Meta().ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return WrapError(CodeDestroyFailed, "remove service "+name, "", errors.Join(errs...))
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.managers, name)
+	return nil
+}
+
+func (r *Registry) Get(name string) (Manager, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	manager, ok := r.managers[name]
+	return manager, ok
+}
+
+// Names returns the registered services in order.
+func (r *Registry) Names() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	names := make([]string, 0, len(r.managers))
+	for name := range r.managers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type ServiceInfo struct {
+	Name    string       `json:"name"`
+	Plugins int          `json:"plugins"`
+	Loaders []LoaderType `json:"loaders"`
+}
+
+// Services describes the registered services in order.
+func (r *Registry) Services() []ServiceInfo {
+	services := make([]ServiceInfo, 0)
+	for _, name := range r.Names() {
+		manager, ok := r.Get(name)
+		if !ok {
+			continue
+		}
+		info := ServiceInfo{
+			Name:    name,
+			Plugins: len(manager.ListPlugins()),
+			Loaders: make([]LoaderType, 0),
+		}
+		if lister, ok := manager.(LoaderLister); ok {
+			for _, loader := range lister.Loaders() {
+				info.Loaders = append(info.Loaders, loader.Name())
+			}
+		}
+		sort.Slice(info.Loaders, func(i, j int) bool { return info.Loaders[i] < info.Loaders[j] })
+		services = append(services, info)
+	}
+	return services
+}
+
+// Registry returns the services of the server.
+func (server *HTTPServer) Registry() *Registry {
+	return server.registry
+}
+
+func (server *HTTPServer) Services(c HttpContext) {
+	c.JSON(200, server.registry.Services())
+}
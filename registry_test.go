@@ -0,0 +1,107 @@
+package goplugify
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRegistryServices(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	registry := server.Registry()
+
+	if err := registry.Add("billing", NewPluginManager("billing")); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := registry.Add("billing", NewPluginManager("billing")); CodeOf(err) != CodeConflict {
+		t.Fatalf("expected conflict on duplicate service, got %v", err)
+	}
+
+	c := putTestPlugin(t, server, "demo", LoaderTypeYaegiHTTP)
+	if c.status != 201 {
+		t.Fatalf("put: %d %v", c.status, c.resp)
+	}
+
+	c = newTestContext()
+	server.Services(c)
+	var services []ServiceInfo
+	c.decode(t, &services)
+	if len(services) != 2 || services[0].Name != "billing" || services[1].Name != "default" {
+		t.Fatalf("unexpected services %+v", services)
+	}
+	if services[1].Plugins != 1 || len(services[1].Loaders) != 4 {
+		t.Errorf("unexpected default service %+v", services[1])
+	}
+
+	if err := registry.Remove(context.Background(), "default"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if names := registry.Names(); len(names) != 1 || names[0] != "billing" {
+		t.Errorf("unexpected services after remove %v", names)
+	}
+}
+
+func TestServiceLoggers(t *testing.T) {
+	// DefaultLogger has no fields, all its pointers may be equal.
+	billingLogger := &struct {
+		DefaultLogger
+		service string
+	}{service: "billing"}
+	billing := NewPluginManager("billing", LoggerComponent(billingLogger))
+	other := NewPluginManager("other")
+	if billing.Components().Logger != billingLogger || billing.scheduler.logger != billingLogger {
+		t.Errorf("expected the billing manager to log to its logger component")
+	}
+	if other.Components().Logger == billingLogger || other.scheduler.logger == billingLogger {
+		t.Errorf("expected the logger of a service not to leak into the others")
+	}
+}
+
+func TestUnknownService(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	handlers := map[string]Handler{
+		"list":       server.List,
+		"run":        server.Run,
+		"unload":     server.Unload,
+		"load":       server.Load,
+		"components": server.Components,
+		"jobs":       server.Jobs,
+	}
+	for name, handler := range handlers {
+		c := newStatusTestContext()
+		c.query["service"] = "missing"
+		c.query["plugin_id"] = "demo"
+		handler(c)
+		if c.status != 404 {
+			t.Errorf("%s: expected 404 for an unknown service, got %d: %v", name, c.status, c.resp)
+		}
+	}
+}
+
+func TestManagerWithoutOptionalMethods(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	// The embedded interface hides the methods of *PluginManager outside of Manager.
+	if err := server.Registry().Add("custom", struct{ Manager }{NewPluginManager("custom")}); err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range server.Registry().Services() {
+		if info.Name == "custom" && len(info.Loaders) != 0 {
+			t.Errorf("expected no loaders for a manager that does not list them, got %v", info.Loaders)
+		}
+	}
+
+	c := newStatusTestContext()
+	c.query["service"] = "custom"
+	c.query["plugin_id"] = "demo"
+	server.Rollback(c)
+	if c.status != 400 {
+		t.Errorf("expected 400 for a manager without rollback, got %d: %v", c.status, c.resp)
+	}
+
+	c = newStatusTestContext()
+	c.query["service"] = "custom"
+	c.form["changes"] = `[{"action": "unload", "plugin_id": "demo"}]`
+	server.Batch(c)
+	if c.status != 400 {
+		t.Errorf("expected 400 for a manager without batches, got %d: %v", c.status, c.resp)
+	}
+}
@@ -0,0 +1,100 @@
+package goplugify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// Response lets a plugin control the HTTP response of a synchronous run instead of
+// the default 200 with its result as JSON. Body is written as is when it is []byte,
+// string or io.Reader, and as JSON otherwise. Async jobs and streams keep the
+// Response as their result.
+type Response struct {
+	// Status defaults to 200.
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// ContentType defaults to one guessed from Body.
+	ContentType string `json:"content_type,omitempty"`
+	Body        any    `json:"body,omitempty"`
+}
+
+// writeRunResult writes the result of a run, honouring a Response. Routers whose
+// contexts do not implement HttpStreamContext can only write JSON bodies without
+// headers.
+func writeRunResult(c HttpContext, result any) error {
+	var resp *Response
+	switch r := result.(type) {
+	case *Response:
+		resp = r
+	case Response:
+		resp = &r
+	}
+	if resp == nil {
+		c.JSON(200, result)
+		return nil
+	}
+
+	status := resp.Status
+	if status == 0 {
+		status = 200
+	}
+	var data []byte
+	var reader io.Reader
+	contentType := resp.ContentType
+	switch body := resp.Body.(type) {
+	case []byte:
+		data = body
+		if contentType == "" {
+			contentType = http.DetectContentType(body)
+		}
+	case string:
+		data = []byte(body)
+		if contentType == "" {
+			contentType = "text/plain; charset=utf-8"
+		}
+	case io.Reader:
+		reader = body
+		if closer, ok := body.(io.Closer); ok {
+			defer closer.Close()
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	default:
+		if contentType == "" && len(resp.Headers) == 0 {
+			if _, ok := c.(HttpStreamContext); !ok {
+				c.JSON(status, body)
+				return nil
+			}
+		}
+		if body != nil {
+			var err error
+			if data, err = json.Marshal(body); err != nil {
+				return NewCodeError(CodeInvalidOutput, "invalid response body: "+err.Error())
+			}
+		}
+		if contentType == "" {
+			contentType = "application/json; charset=utf-8"
+		}
+	}
+
+	sc, ok := c.(HttpStreamContext)
+	if !ok {
+		return NewCodeError(CodeInvalidOutput, "raw plugin responses are not supported by the http router")
+	}
+	if data != nil || reader != nil {
+		sc.SetHeader("Content-Type", contentType)
+	}
+	for key, value := range resp.Headers {
+		sc.SetHeader(key, value)
+	}
+	sc.WriteHeader(status)
+	// The status is sent, errors of the client connection can only be dropped.
+	if reader != nil {
+		io.Copy(sc, reader)
+	} else if data != nil {
+		sc.Write(data)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package goplugify
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPluginResponse(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	manager, _ := server.Registry().Get("default")
+	manager.AddPlugin(&Plugin{
+		MetaInfo: &Meta{ID: "native"},
+		run: func(input any) (any, error) {
+			switch input.(*RunRequest).Query.Get("kind") {
+			case "csv":
+				return &Response{Headers: map[string]string{"Content-Disposition": "attachment"}, ContentType: "text/csv", Body: "a,b\n1,2\n"}, nil
+			case "reader":
+				return Response{Status: 202, Body: strings.NewReader("raw")}, nil
+			case "redirect":
+				return &Response{Status: 302, Headers: map[string]string{"Location": "/elsewhere"}}, nil
+			case "missing":
+				return &Response{Status: 404, Body: map[string]any{"found": false}}, nil
+			}
+			return "plain", nil
+		},
+	})
+	router := NewServeMuxRouter(nil)
+	server.RegisterRoutes(router, "/api")
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	tests := []struct {
+		kind, contentType, body string
+		status                  int
+	}{
+		{"csv", "text/csv", "a,b\n1,2\n", 200},
+		{"reader", "application/octet-stream", "raw", 202},
+		{"redirect", "", "", 302},
+		{"missing", "application/json; charset=utf-8", `{"found":false}`, 404},
+		{"", "application/json; charset=utf-8", `"plain"`, 200},
+	}
+	for _, tt := range tests {
+		resp, err := client.Post(ts.URL+"/api/plugin/run?plugin_id=native&kind="+tt.kind, "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || strings.TrimSpace(string(body)) != strings.TrimSpace(tt.body) {
+			t.Errorf("%s: unexpected response %d %q", tt.kind, resp.StatusCode, body)
+		}
+		if tt.contentType != "" && resp.Header.Get("Content-Type") != tt.contentType {
+			t.Errorf("%s: unexpected content type %q", tt.kind, resp.Header.Get("Content-Type"))
+		}
+	}
+	resp, _ := client.Post(ts.URL+"/api/plugin/run?plugin_id=native&kind=redirect", "application/json", nil)
+	resp.Body.Close()
+	if resp.Header.Get("Location") != "/elsewhere" {
+		t.Errorf("expected the plugin headers, got %v", resp.Header)
+	}
+
+	// Contexts without HttpStreamContext still get JSON descriptors.
+	c := newTestContext()
+	c.query["plugin_id"] = "native"
+	server.Run(c)
+	if c.status != 200 || c.resp != "plain" {
+		t.Errorf("unexpected plain response %d: %v", c.status, c.resp)
+	}
+	err := writeRunResult(c, &Response{Status: 404, Body: map[string]any{"found": false}})
+	if err != nil || c.status != 404 {
+		t.Errorf("expected a JSON fallback, got %d: %v", c.status, err)
+	}
+	if err := writeRunResult(c, &Response{Body: []byte("raw")}); CodeOf(err) != CodeInvalidOutput {
+		t.Errorf("expected raw bodies to be rejected, got %v", err)
+	}
+}
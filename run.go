@@ -0,0 +1,195 @@
+package goplugify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	TriggerHTTP     = "http"
+	TriggerAsync    = "async"
+	TriggerStream   = "stream"
+	TriggerSchedule = "schedule"
+)
+
+// DefaultRunHeaders are the request headers copied into RunRequest.Headers.
+var DefaultRunHeaders = []string{
+	"Accept", "Accept-Language", "Content-Type", "User-Agent",
+	"X-Forwarded-For", "X-Real-Ip", "X-Request-Id",
+}
+
+// DefaultMaxBodySize caps the bodies read whole by the server, the inputs of runs
+// and method calls, see HTTPServer.SetMaxBodySize.
+var DefaultMaxBodySize int64 = 10 << 20
+
+// RunRequest is the input of every plugin run, whatever started it. Native plugins
+// receive it as their Run argument, yaegi scripts as input["input"] along with its
+// fields as plain values, see runInputMap.
+type RunRequest struct {
+	context.Context `json:"-"`
+
+	ID       string `json:"id"`
+	Service  string `json:"service"`
+	PluginID string `json:"plugin_id"`
+	// Trigger is what started the run, one of the Trigger constants.
+	Trigger string    `json:"trigger"`
+	Time    time.Time `json:"time"`
+	// Caller is the app ID authenticated for the request, empty when it is not signed.
+	Caller string `json:"caller,omitempty"`
+
+	// Input is the decoded JSON body, nil when the body is empty or its Content-Type
+	// is neither JSON nor missing.
+	Input   any               `json:"input,omitempty"`
+	Body    []byte            `json:"-"`
+	Query   url.Values        `json:"query,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Raw is the context of the request for advanced cases, such as multipart
+	// uploads or writing the response directly.
+	Raw HttpContext `json:"-"`
+
+	emitter Emitter
+}
+
+func (r *RunRequest) Emitter() Emitter {
+	if r.emitter == nil {
+		return nopEmitter{}
+	}
+	return r.emitter
+}
+
+// newRunRequest reads and decodes the body of c and checks it against the input
+// schema of plugin. The body stays readable through Raw.
+func (server *HTTPServer) newRunRequest(c HttpContext, serviceName string, plugin IPlugin, trigger string) (*RunRequest, error) {
+	meta := plugin.Meta()
+	req := &RunRequest{
+		Context:  c,
+		ID:       c.GetHeader("X-Request-Id"),
+		Service:  serviceName,
+		PluginID: meta.ID,
+		Trigger:  trigger,
+		Time:     time.Now(),
+		Caller:   AppIDOf(c),
+		Query:    url.Values{},
+		Headers:  make(map[string]string),
+		Raw:      c,
+	}
+	if req.ID == "" {
+		req.ID = newJobID()
+	}
+	if rc, ok := c.(HttpRequestContext); ok && rc.Request() != nil {
+		req.Query = rc.Request().URL.Query()
+	}
+	for _, key := range server.runHeaders() {
+		if value := c.GetHeader(key); value != "" {
+			req.Headers[key] = value
+		}
+	}
+
+	// Form bodies belong to the routes that load plugins, they stay untouched. They
+	// carry no input to check against a schema.
+	contentType := c.GetHeader("Content-Type")
+	if strings.Contains(contentType, "multipart/form-data") || strings.Contains(contentType, "application/x-www-form-urlencoded") {
+		if len(meta.InputSchema) > 0 {
+			return nil, WrapError(CodeInvalidRequest, "run", meta.ID, errors.New("the input of a plugin with an input schema must be sent as JSON"))
+		}
+		return req, nil
+	}
+	body, err := readBody(c, server.maxBodySize())
+	if err != nil {
+		return nil, err
+	}
+	req.Body = body
+	req.Raw = &bodyContext{HttpContext: c, body: body}
+	// Bodies without a Content-Type are JSON too, other ones are left to the plugin in Body.
+	if contentType == "" || strings.Contains(contentType, "json") {
+		if req.Input, err = decodeInput(body); err != nil {
+			return nil, err
+		}
+	}
+	if len(meta.InputSchema) > 0 {
+		if err := checkSchema(meta.InputSchema, req.Input, CodeInvalidRequest, "input"); err != nil {
+			return nil, WrapError(CodeInvalidRequest, "run", meta.ID, err)
+		}
+	}
+	return req, nil
+}
+
+// readBody reads the body of c whole, failing with ErrBodyTooLarge past limit bytes.
+func readBody(c HttpContext, limit int64) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(nil, c.Body(), limit))
+	var maxBytes *http.MaxBytesError
+	if errors.As(err, &maxBytes) {
+		return nil, fmt.Errorf("%w: body exceeds %d bytes", ErrBodyTooLarge, limit)
+	}
+	return body, err
+}
+
+// bodyContext replays a request body that was already read.
+type bodyContext struct {
+	HttpContext
+	body []byte
+}
+
+func (c *bodyContext) Body() io.ReadCloser     { return io.NopCloser(bytes.NewReader(c.body)) }
+func (c *bodyContext) Param(key string) string { return PathParam(c.HttpContext, key) }
+func (c *bodyContext) Request() *http.Request {
+	if rc, ok := c.HttpContext.(HttpRequestContext); ok {
+		return rc.Request()
+	}
+	return nil
+}
+
+func (server *HTTPServer) runHeaders() []string {
+	server.lock.RLock()
+	defer server.lock.RUnlock()
+	if server.headers == nil {
+		return DefaultRunHeaders
+	}
+	return server.headers
+}
+
+// SetRunHeaders replaces the request headers copied into RunRequest.Headers.
+func (server *HTTPServer) SetRunHeaders(headers ...string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.headers = headers
+}
+
+func (server *HTTPServer) maxBodySize() int64 {
+	server.lock.RLock()
+	defer server.lock.RUnlock()
+	if server.maxBody <= 0 {
+		return DefaultMaxBodySize
+	}
+	return server.maxBody
+}
+
+// SetMaxBodySize caps the bodies of runs and method calls to limit bytes, larger
+// ones are rejected with too_large. DefaultMaxBodySize applies when limit is 0.
+func (server *HTTPServer) SetMaxBodySize(limit int64) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.maxBody = limit
+}
+
+// runInputMap is the argument of the Run function of yaegi scripts.
+func runInputMap(a any) map[string]any {
+	input := map[string]any{"input": a, "emitter": EmitterOf(a)}
+	if req, ok := a.(*RunRequest); ok {
+		input["body"] = req.Input
+		input["query"] = map[string][]string(req.Query)
+		input["headers"] = req.Headers
+		input["request_id"] = req.ID
+		input["caller"] = req.Caller
+		input["trigger"] = req.Trigger
+	}
+	return input
+}
@@ -0,0 +1,160 @@
+package goplugify
+
+import (
+	"context"
+	"io"
+	"testing"
+)
+
+func TestRunRequest(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	manager, _ := server.Registry().Get("default")
+
+	var got *RunRequest
+	manager.AddPlugin(&Plugin{
+		MetaInfo: &Meta{ID: "native"},
+		run: func(input any) (any, error) {
+			got, _ = input.(*RunRequest)
+			body, _ := io.ReadAll(got.Raw.Body())
+			return string(body), nil
+		},
+	})
+
+	c := newTestContext()
+	c.Context = context.WithValue(c.Context, AppIDKey, "console")
+	c.query["plugin_id"] = "native"
+	c.headers["X-Request-Id"] = "req-1"
+	c.headers["Content-Type"] = "application/json"
+	c.headers["Authorization"] = "secret"
+	c.body = []byte(`{"name": "x"}`)
+	server.Run(c)
+	if c.status != 200 || c.resp != `{"name": "x"}` {
+		t.Fatalf("expected the raw body to stay readable, got %d: %v", c.status, c.resp)
+	}
+	if got == nil {
+		t.Fatal("expected a *RunRequest input")
+	}
+	if got.ID != "req-1" || got.Caller != "console" || got.Trigger != TriggerHTTP || got.PluginID != "native" || got.Service != "default" {
+		t.Errorf("unexpected run request %+v", got)
+	}
+	if input, _ := got.Input.(map[string]any); input["name"] != "x" {
+		t.Errorf("expected the decoded body, got %v", got.Input)
+	}
+	if got.Headers["Content-Type"] != "application/json" || got.Headers["Authorization"] != "" {
+		t.Errorf("expected only the selected headers, got %v", got.Headers)
+	}
+
+	c = newTestContext()
+	c.query["plugin_id"] = "native"
+	c.headers["X-Go-Plugify-Appid"] = "console"
+	server.Run(c)
+	if c.status != 200 || got.Caller != "" {
+		t.Errorf("expected the unsigned app ID not to be the caller, got %q", got.Caller)
+	}
+
+	c = newStatusTestContext()
+	c.query["plugin_id"] = "native"
+	c.headers["Content-Type"] = "application/json"
+	c.body = []byte(`{`)
+	server.Run(c)
+	if c.status != 400 {
+		t.Errorf("expected 400 for an invalid JSON body, got %d: %v", c.status, c.resp)
+	}
+
+	c = newStatusTestContext()
+	c.query["plugin_id"] = "native"
+	c.body = []byte(`{`)
+	server.Run(c)
+	if c.status != 400 {
+		t.Errorf("expected a body without Content-Type to be decoded as JSON, got %d: %v", c.status, c.resp)
+	}
+
+	c = newTestContext()
+	c.query["plugin_id"] = "native"
+	c.headers["Content-Type"] = "text/plain"
+	c.body = []byte(`{`)
+	server.Run(c)
+	if c.status != 200 || got.Input != nil || string(got.Body) != `{` {
+		t.Errorf("expected a text body to be left undecoded, got %d: %v %v", c.status, c.resp, got.Input)
+	}
+
+	c = newTestContext()
+	c.query["plugin_id"] = "native"
+	server.Run(c)
+	if c.status != 200 || got.ID == "" || got.Input != nil {
+		t.Errorf("expected a generated request id and no input, got %+v", got)
+	}
+}
+
+func TestRunRequestYaegi(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	c := newTestContext()
+	c.params["id"] = "script"
+	c.form["meta"] = `{"loader": "yaegi_http"}`
+	c.body = []byte(`package main
+
+func Run(input map[string]any) (any, error) {
+	body := input["body"].(map[string]any)
+	return map[string]any{"name": body["name"], "trigger": input["trigger"], "request_id": input["request_id"]}, nil
+}
+
+func Methods() map[string]func(any) any { return nil }
+
+func Destroy(input map[string]any) error { return nil }
+`)
+	server.putPluginV2(c)
+	if c.status != 201 {
+		t.Fatalf("put: %d %v", c.status, c.resp)
+	}
+
+	c = newTestContext()
+	c.query["plugin_id"] = "script"
+	c.headers["X-Request-Id"] = "req-2"
+	c.headers["Content-Type"] = "application/json"
+	c.body = []byte(`{"name": "y"}`)
+	server.Run(c)
+	resp, _ := c.resp.(map[string]any)
+	if c.status != 200 || resp["name"] != "y" || resp["trigger"] != TriggerHTTP || resp["request_id"] != "req-2" {
+		t.Errorf("unexpected response %d: %v", c.status, c.resp)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	putTestPlugin(t, server, "demo", LoaderTypeYaegiHTTP)
+	server.SetMaxBodySize(8)
+	body := []byte(`{"name": "too long"}`)
+
+	c := newTestContext()
+	c.query["plugin_id"] = "demo"
+	c.headers["Content-Type"] = "application/json"
+	c.body = body
+	server.Run(c)
+	if c.status != 413 {
+		t.Errorf("expected 413 for a run body over the limit, got %d: %v", c.status, c.resp)
+	}
+
+	// Form bodies are only read whole when the run outlives the request.
+	c = newTestContext()
+	c.query["plugin_id"] = "demo"
+	c.query["async"] = "true"
+	c.headers["Content-Type"] = "application/x-www-form-urlencoded"
+	c.body = []byte("name=too+long")
+	server.Run(c)
+	if c.status != 413 {
+		t.Errorf("expected 413 for an async body over the limit, got %d: %v", c.status, c.resp)
+	}
+
+	c = newTestContext()
+	c.params["id"] = "demo"
+	c.params["name"] = "echo"
+	c.body = body
+	server.callMethodV2(c)
+	var resp struct {
+		Error APIError `json:"error"`
+	}
+	c.decode(t, &resp)
+	if c.status != 413 || resp.Error.Code != CodeTooLarge {
+		t.Errorf("expected too_large for a method input over the limit, got %d: %v", c.status, c.resp)
+	}
+}
@@ -0,0 +1,238 @@
+package goplugify
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// OverlapPolicy decides what happens when a scheduled run is due while the previous
+// one is still running.
+type OverlapPolicy string
+
+const (
+	// OverlapSkip drops the run that is due, it is the default.
+	OverlapSkip OverlapPolicy = "skip"
+	// OverlapQueue starts the run that is due once the previous one returns, runs due
+	// meanwhile are coalesced into one.
+	OverlapQueue OverlapPolicy = "queue"
+)
+
+// Schedule makes the manager run a plugin periodically, either on a cron expression
+// or every Interval (a Go duration such as "5m"). Scheduled runs get a *RunRequest
+// whose Trigger is TriggerSchedule.
+type Schedule struct {
+	Cron     string        `json:"cron,omitempty"`
+	Interval string        `json:"interval,omitempty"`
+	Overlap  OverlapPolicy `json:"overlap,omitempty"`
+	// Jitter is the upper bound of a random delay added to every run, a Go duration.
+	Jitter string `json:"jitter,omitempty"`
+}
+
+// parse returns the function computing the run after a given time, and the jitter.
+func (s *Schedule) parse() (func(time.Time) time.Time, time.Duration, error) {
+	var jitter time.Duration
+	if s.Jitter != "" {
+		d, err := time.ParseDuration(s.Jitter)
+		if err != nil || d < 0 {
+			return nil, 0, fmt.Errorf("invalid jitter %q", s.Jitter)
+		}
+		jitter = d
+	}
+	switch s.Overlap {
+	case "", OverlapSkip, OverlapQueue:
+	default:
+		return nil, 0, fmt.Errorf("invalid overlap policy %q", s.Overlap)
+	}
+
+	switch {
+	case s.Cron != "" && s.Interval != "":
+		return nil, 0, fmt.Errorf("cron and interval are mutually exclusive")
+	case s.Cron != "":
+		cron, err := ParseCron(s.Cron)
+		if err != nil {
+			return nil, 0, err
+		}
+		return cron.Next, jitter, nil
+	case s.Interval != "":
+		interval, err := time.ParseDuration(s.Interval)
+		if err != nil || interval < time.Second {
+			return nil, 0, fmt.Errorf("invalid interval %q, at least 1s is required", s.Interval)
+		}
+		return func(t time.Time) time.Time { return t.Add(interval) }, jitter, nil
+	}
+	return nil, 0, fmt.Errorf("cron or interval is required")
+}
+
+// Validate reports whether the schedule can be started.
+func (s *Schedule) Validate() error {
+	_, _, err := s.parse()
+	return err
+}
+
+type scheduler struct {
+	logger  Logger
+	entries map[string]*scheduleEntry
+	lock    sync.Mutex
+}
+
+type scheduleEntry struct {
+	logger  Logger
+	service string
+	plugin  IPlugin
+	overlap OverlapPolicy
+	next    func(time.Time) time.Time
+	jitter  time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	lock    sync.Mutex
+	running bool
+	pending bool
+}
+
+// set starts the schedule of plugin, replacing the one it had. Plugins without a
+// schedule only have theirs stopped.
+func (s *scheduler) set(service string, plugin IPlugin) error {
+	id := plugin.Meta().ID
+	schedule := plugin.Meta().Schedule
+	if schedule == nil {
+		s.stop(id)
+		return nil
+	}
+	next, jitter, err := schedule.parse()
+	if err != nil {
+		return err
+	}
+
+	s.stop(id)
+	ctx, cancel := context.WithCancel(context.Background())
+	entry := &scheduleEntry{
+		logger:  s.logger,
+		service: service,
+		plugin:  plugin,
+		overlap: schedule.Overlap,
+		next:    next,
+		jitter:  jitter,
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+
+	s.lock.Lock()
+	if s.entries == nil {
+		s.entries = make(map[string]*scheduleEntry)
+	}
+	s.entries[id] = entry
+	s.lock.Unlock()
+
+	// The first run time is published before returning so that it shows up right away.
+	go entry.loop(entry.nextRun())
+	return nil
+}
+
+// stop cancels the schedule of pluginID and waits for its timer loop to exit. A run
+// in progress is canceled through its context but not waited for.
+func (s *scheduler) stop(pluginID string) {
+	s.lock.Lock()
+	entry, ok := s.entries[pluginID]
+	delete(s.entries, pluginID)
+	s.lock.Unlock()
+	if !ok {
+		return
+	}
+	entry.cancel()
+	<-entry.done
+}
+
+// nextRun computes and publishes the next run time, zero when there is none.
+func (e *scheduleEntry) nextRun() time.Time {
+	at := e.next(time.Now())
+	if at.IsZero() {
+		setNextRunTime(e.plugin, nil)
+		return at
+	}
+	if e.jitter > 0 {
+		at = at.Add(time.Duration(rand.Int63n(int64(e.jitter))))
+	}
+	setNextRunTime(e.plugin, &at)
+	return at
+}
+
+func (e *scheduleEntry) loop(at time.Time) {
+	defer close(e.done)
+	defer setNextRunTime(e.plugin, nil)
+
+	for ; !at.IsZero(); at = e.nextRun() {
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-e.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			e.fire(at)
+		}
+	}
+}
+
+func (e *scheduleEntry) fire(at time.Time) {
+	e.lock.Lock()
+	if e.running {
+		if e.overlap == OverlapQueue {
+			e.pending = true
+		}
+		e.lock.Unlock()
+		return
+	}
+	e.running = true
+	e.lock.Unlock()
+
+	go func() {
+		for {
+			e.run(at)
+			e.lock.Lock()
+			if !e.pending || e.ctx.Err() != nil {
+				e.running, e.pending = false, false
+				e.lock.Unlock()
+				return
+			}
+			e.pending = false
+			e.lock.Unlock()
+			at = time.Now()
+		}
+	}()
+}
+
+func (e *scheduleEntry) run(at time.Time) {
+	id := e.plugin.Meta().ID
+	defer func() {
+		if r := recover(); r != nil {
+			e.logger.Error("scheduled run of plugin %s panicked: %v", id, r)
+		}
+	}()
+	_, err := e.plugin.OnRun(&RunRequest{
+		Context:  e.ctx,
+		ID:       newJobID(),
+		Service:  e.service,
+		PluginID: id,
+		Trigger:  TriggerSchedule,
+		Time:     at,
+		Query:    url.Values{},
+		Headers:  map[string]string{},
+		Raw:      newEmptyContext(e.ctx),
+	})
+	if err != nil {
+		e.logger.Error("scheduled run of plugin %s failed: %v", id, err)
+	}
+}
+
+func setNextRunTime(plugin IPlugin, next *time.Time) {
+	if p, ok := plugin.(interface{ setNextRunTime(*time.Time) }); ok {
+		p.setNextRunTime(next)
+	}
+}
@@ -0,0 +1,89 @@
+package goplugify
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2024, 1, 31, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/5 * * * *", time.Date(2024, 1, 31, 10, 10, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2024, 2, 1, 2, 30, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * 7", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		cron, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.expr, err)
+		}
+		if got := cron.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.expr, tt.want, got)
+		}
+	}
+
+	for _, expr := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("expected %q to be rejected", expr)
+		}
+	}
+}
+
+func TestSchedulerRunsPlugin(t *testing.T) {
+	var runs atomic.Int32
+	plugin := &Plugin{
+		MetaInfo: &Meta{ID: "tick", Schedule: &Schedule{Interval: "1s"}},
+		run: func(input any) (any, error) {
+			if req, ok := input.(*RunRequest); !ok || req.Trigger != TriggerSchedule || req.Raw == nil {
+				t.Errorf("unexpected scheduled input %#v", input)
+			}
+			runs.Add(1)
+			return nil, nil
+		},
+	}
+
+	s := &scheduler{logger: &DefaultLogger{}}
+	if err := s.set("default", plugin); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	plugin.stateLock.RLock()
+	next := plugin.NextRunTime
+	plugin.stateLock.RUnlock()
+	if next == nil || next.Before(time.Now()) {
+		t.Fatalf("expected a next run time in the future, got %v", next)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for runs.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if runs.Load() == 0 {
+		t.Fatal("scheduled run did not happen")
+	}
+
+	s.stop("tick")
+	plugin.stateLock.RLock()
+	next = plugin.NextRunTime
+	plugin.stateLock.RUnlock()
+	if next != nil {
+		t.Errorf("expected no next run time once stopped, got %v", next)
+	}
+}
+
+func TestLoadRejectsInvalidSchedule(t *testing.T) {
+	manager := InitPluginManagers("default")["default"]
+	meta := &Meta{ID: "bad", Loader: LoaderTypeYaegiHTTP, Schedule: &Schedule{Cron: "* * *"}}
+	if _, err := manager.LoadPlugin(context.Background(), meta, nil); CodeOf(err) != CodeInvalidMeta {
+		t.Fatalf("expected invalid_meta, got %v", err)
+	}
+}
@@ -0,0 +1,371 @@
+package goplugify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MethodSchema holds the JSON Schemas of the input and output of a plugin method.
+type MethodSchema struct {
+	Input  json.RawMessage `json:"input,omitempty"`
+	Output json.RawMessage `json:"output,omitempty"`
+}
+
+// SchemaViolation is one mismatch between a value and its schema. Path is a JSON
+// Pointer to the offending value.
+type SchemaViolation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// jsonSchema is the subset of JSON Schema the server validates: type, enum, const,
+// properties, required, additionalProperties, items, numeric and length bounds,
+// pattern, allOf, anyOf and oneOf. Other keywords are ignored.
+type jsonSchema struct {
+	types                []string
+	enum                 []any
+	constant             *any
+	properties           map[string]*jsonSchema
+	required             []string
+	additionalProperties *jsonSchema
+	noAdditional         bool
+	items                *jsonSchema
+	minimum, maximum     *float64
+	exclusiveMinimum     *float64
+	exclusiveMaximum     *float64
+	minLength, maxLength *int
+	minItems, maxItems   *int
+	pattern              *regexp.Regexp
+	allOf, anyOf, oneOf  []*jsonSchema
+}
+
+type rawSchema struct {
+	Type                 json.RawMessage            `json:"type"`
+	Enum                 []any                      `json:"enum"`
+	Const                *json.RawMessage           `json:"const"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+	Items                json.RawMessage            `json:"items"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+	ExclusiveMinimum     *float64                   `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64                   `json:"exclusiveMaximum"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+	MinItems             *int                       `json:"minItems"`
+	MaxItems             *int                       `json:"maxItems"`
+	Pattern              string                     `json:"pattern"`
+	AllOf                []json.RawMessage          `json:"allOf"`
+	AnyOf                []json.RawMessage          `json:"anyOf"`
+	OneOf                []json.RawMessage          `json:"oneOf"`
+}
+
+// compileSchema parses a JSON Schema, nil when raw is empty.
+func compileSchema(raw json.RawMessage) (*jsonSchema, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+	switch string(raw) {
+	case "true":
+		return &jsonSchema{}, nil
+	case "false":
+		return &jsonSchema{types: []string{}}, nil
+	}
+
+	var r rawSchema
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	s := &jsonSchema{
+		enum:             r.Enum,
+		required:         r.Required,
+		minimum:          r.Minimum,
+		maximum:          r.Maximum,
+		exclusiveMinimum: r.ExclusiveMinimum,
+		exclusiveMaximum: r.ExclusiveMaximum,
+		minLength:        r.MinLength,
+		maxLength:        r.MaxLength,
+		minItems:         r.MinItems,
+		maxItems:         r.MaxItems,
+	}
+	if len(r.Type) > 0 {
+		var single string
+		if err := json.Unmarshal(r.Type, &single); err == nil {
+			s.types = []string{single}
+		} else if err := json.Unmarshal(r.Type, &s.types); err != nil {
+			return nil, fmt.Errorf("invalid schema type %s", r.Type)
+		}
+	}
+	if r.Const != nil {
+		var v any
+		json.Unmarshal(*r.Const, &v)
+		s.constant = &v
+	}
+	if r.Pattern != "" {
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema pattern %q: %v", r.Pattern, err)
+		}
+		s.pattern = pattern
+	}
+
+	var err error
+	if len(r.Properties) > 0 {
+		s.properties = make(map[string]*jsonSchema)
+		for name, prop := range r.Properties {
+			if s.properties[name], err = compileSchema(prop); err != nil {
+				return nil, fmt.Errorf("property %s: %w", name, err)
+			}
+		}
+	}
+	if string(bytes.TrimSpace(r.AdditionalProperties)) == "false" {
+		s.noAdditional = true
+	} else if s.additionalProperties, err = compileSchema(r.AdditionalProperties); err != nil {
+		return nil, fmt.Errorf("additionalProperties: %w", err)
+	}
+	if s.items, err = compileSchema(r.Items); err != nil {
+		return nil, fmt.Errorf("items: %w", err)
+	}
+	for _, group := range []struct {
+		raw []json.RawMessage
+		out *[]*jsonSchema
+	}{{r.AllOf, &s.allOf}, {r.AnyOf, &s.anyOf}, {r.OneOf, &s.oneOf}} {
+		for _, sub := range group.raw {
+			compiled, err := compileSchema(sub)
+			if err != nil {
+				return nil, err
+			}
+			if compiled == nil {
+				compiled = &jsonSchema{}
+			}
+			*group.out = append(*group.out, compiled)
+		}
+	}
+	return s, nil
+}
+
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func (s *jsonSchema) validate(path string, v any, out *[]SchemaViolation) {
+	if s == nil {
+		return
+	}
+	report := func(format string, args ...any) {
+		p := path
+		if p == "" {
+			p = "/"
+		}
+		*out = append(*out, SchemaViolation{Path: p, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.types != nil {
+		actual := jsonType(v)
+		matched := false
+		for _, t := range s.types {
+			if t == actual || (t == "number" && actual == "integer") {
+				matched = true
+			}
+		}
+		if !matched {
+			if len(s.types) == 0 {
+				report("no value is allowed")
+			} else {
+				report("expected %s, got %s", strings.Join(s.types, " or "), actual)
+			}
+			return
+		}
+	}
+	if s.enum != nil {
+		found := false
+		for _, e := range s.enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+			}
+		}
+		if !found {
+			report("must be one of %v", s.enum)
+		}
+	}
+	if s.constant != nil && !reflect.DeepEqual(*s.constant, v) {
+		report("must be %v", *s.constant)
+	}
+
+	switch v := v.(type) {
+	case float64:
+		if s.minimum != nil && v < *s.minimum {
+			report("must be >= %v", *s.minimum)
+		}
+		if s.maximum != nil && v > *s.maximum {
+			report("must be <= %v", *s.maximum)
+		}
+		if s.exclusiveMinimum != nil && v <= *s.exclusiveMinimum {
+			report("must be > %v", *s.exclusiveMinimum)
+		}
+		if s.exclusiveMaximum != nil && v >= *s.exclusiveMaximum {
+			report("must be < %v", *s.exclusiveMaximum)
+		}
+	case string:
+		length := len([]rune(v))
+		if s.minLength != nil && length < *s.minLength {
+			report("must be at least %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			report("must be at most %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			report("must match %s", s.pattern)
+		}
+	case []any:
+		if s.minItems != nil && len(v) < *s.minItems {
+			report("must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			report("must have at most %d items", *s.maxItems)
+		}
+		for i, item := range v {
+			s.items.validate(fmt.Sprintf("%s/%d", path, i), item, out)
+		}
+	case map[string]any:
+		for _, name := range s.required {
+			if _, ok := v[name]; !ok {
+				*out = append(*out, SchemaViolation{Path: path + "/" + escapePointer(name), Message: "is required"})
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := path + "/" + escapePointer(name)
+			if prop, ok := s.properties[name]; ok {
+				prop.validate(child, v[name], out)
+			} else if s.noAdditional {
+				*out = append(*out, SchemaViolation{Path: child, Message: "is not allowed"})
+			} else {
+				s.additionalProperties.validate(child, v[name], out)
+			}
+		}
+	}
+
+	for _, sub := range s.allOf {
+		sub.validate(path, v, out)
+	}
+	if len(s.anyOf) > 0 && s.matching(s.anyOf, v) == 0 {
+		report("must match at least one schema of anyOf")
+	}
+	if len(s.oneOf) > 0 {
+		if n := s.matching(s.oneOf, v); n != 1 {
+			report("must match exactly one schema of oneOf, matched %d", n)
+		}
+	}
+}
+
+func (s *jsonSchema) matching(schemas []*jsonSchema, v any) int {
+	n := 0
+	for _, sub := range schemas {
+		var violations []SchemaViolation
+		sub.validate("", v, &violations)
+		if len(violations) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func escapePointer(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
+
+// ValidateSchema validates a decoded JSON value against the JSON Schema in raw.
+func ValidateSchema(raw json.RawMessage, v any) ([]SchemaViolation, error) {
+	schema, err := compileSchema(raw)
+	if err != nil {
+		return nil, err
+	}
+	var violations []SchemaViolation
+	schema.validate("", v, &violations)
+	return violations, nil
+}
+
+// validateMetaSchemas reports the first schema of meta that does not compile.
+func validateMetaSchemas(meta *Meta) error {
+	if _, err := compileSchema(meta.InputSchema); err != nil {
+		return fmt.Errorf("input_schema: %v", err)
+	}
+	for name, method := range meta.Methods {
+		if _, err := compileSchema(method.Input); err != nil {
+			return fmt.Errorf("methods.%s.input: %v", name, err)
+		}
+		if _, err := compileSchema(method.Output); err != nil {
+			return fmt.Errorf("methods.%s.output: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// schemaError describes the violations of what, "input" or "output", as an error
+// whose details list them.
+func schemaError(code ErrorCode, what string, violations []SchemaViolation) error {
+	parts := make([]string, 0, len(violations))
+	for _, v := range violations {
+		parts = append(parts, v.Path+" "+v.Message)
+	}
+	return &PlugifyError{
+		Code:    code,
+		message: fmt.Sprintf("%s does not match the schema: %s", what, strings.Join(parts, "; ")),
+		Details: violations,
+	}
+}
+
+// checkSchema validates v against raw, a compile error of raw is reported as a
+// server side error since the schema was accepted at load time.
+func checkSchema(raw json.RawMessage, v any, code ErrorCode, what string) error {
+	violations, err := ValidateSchema(raw, v)
+	if err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return schemaError(code, what, violations)
+	}
+	return nil
+}
+
+// decodeInput decodes a JSON request body, an empty body is null.
+func decodeInput(body []byte) (any, error) {
+	var input any
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+	if err := json.Unmarshal(body, &input); err != nil {
+		return nil, NewCodeError(CodeInvalidRequest, fmt.Sprintf("invalid input: %v", err))
+	}
+	return input, nil
+}
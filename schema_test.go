@@ -0,0 +1,136 @@
+package goplugify
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestValidateSchema(t *testing.T) {
+	schema := json.RawMessage(`{
+		"type": "object",
+		"required": ["id", "mode"],
+		"additionalProperties": false,
+		"properties": {
+			"id": {"type": "integer", "minimum": 1},
+			"mode": {"enum": ["dry-run", "apply"]},
+			"tags": {"type": "array", "maxItems": 2, "items": {"type": "string", "pattern": "^[a-z]+$"}},
+			"note": {"type": ["string", "null"], "maxLength": 5}
+		}
+	}`)
+	tests := []struct {
+		input string
+		paths []string
+	}{
+		{`{"id": 3, "mode": "apply"}`, nil},
+		{`{"id": 3, "mode": "apply", "note": null, "tags": ["a"]}`, nil},
+		{`{"mode": "apply"}`, []string{"/id"}},
+		{`{"id": 1.5, "mode": "x"}`, []string{"/id", "/mode"}},
+		{`{"id": 0, "mode": "apply", "extra": true}`, []string{"/extra", "/id"}},
+		{`{"id": 1, "mode": "apply", "tags": ["a", "B", "c"], "note": "too long"}`, []string{"/note", "/tags", "/tags/1"}},
+		{`[1]`, []string{"/"}},
+	}
+	for _, tt := range tests {
+		var input any
+		json.Unmarshal([]byte(tt.input), &input)
+		violations, err := ValidateSchema(schema, input)
+		if err != nil {
+			t.Fatalf("validate: %v", err)
+		}
+		if len(violations) != len(tt.paths) {
+			t.Errorf("%s: expected violations at %v, got %+v", tt.input, tt.paths, violations)
+			continue
+		}
+		for i, v := range violations {
+			if v.Path != tt.paths[i] {
+				t.Errorf("%s: expected a violation at %s, got %+v", tt.input, tt.paths[i], v)
+			}
+		}
+	}
+
+	if _, err := ValidateSchema(json.RawMessage(`{"pattern": "("}`), "x"); err == nil {
+		t.Error("expected an invalid pattern to be rejected")
+	}
+}
+
+func TestSchemaValidatedRoutes(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	c := newTestContext()
+	c.params["id"] = "demo"
+	c.form["meta"] = `{"loader": "yaegi_http",
+		"input_schema": {"type": "object", "required": ["id"]},
+		"methods": {"echo": {"input": {"type": "object", "required": ["a"]}, "output": {"type": "object", "required": ["b"]}}}}`
+	c.body = []byte(testScript)
+	server.putPluginV2(c)
+	if c.status != 201 {
+		t.Fatalf("put: %d %v", c.status, c.resp)
+	}
+
+	c = newTestContext()
+	c.query["plugin_id"] = "demo"
+	c.headers["Content-Type"] = "application/json"
+	c.body = []byte(`{}`)
+	server.Run(c)
+	if c.status != 400 {
+		t.Errorf("expected 400 for an invalid run input, got %d: %v", c.status, c.resp)
+	}
+	c = newTestContext()
+	c.query["plugin_id"] = "demo"
+	c.headers["Content-Type"] = "application/json"
+	c.body = []byte(`{"id": 1}`)
+	server.Run(c)
+	if c.status != 200 {
+		t.Errorf("expected 200 for a valid run input, got %d: %v", c.status, c.resp)
+	}
+	c = newTestContext()
+	c.query["plugin_id"] = "demo"
+	c.body = []byte(`{"id": 1}`)
+	server.Run(c)
+	if c.status != 200 {
+		t.Errorf("expected a body without Content-Type to be checked as JSON, got %d: %v", c.status, c.resp)
+	}
+	for _, contentType := range []string{"application/x-www-form-urlencoded", "multipart/form-data; boundary=x"} {
+		c = newStatusTestContext()
+		c.query["plugin_id"] = "demo"
+		c.headers["Content-Type"] = contentType
+		c.body = []byte(`{}`)
+		server.Run(c)
+		if c.status != 400 {
+			t.Errorf("expected 400 for a %s run input, got %d: %v", contentType, c.status, c.resp)
+		}
+	}
+
+	c = newTestContext()
+	c.params["id"] = "demo"
+	c.params["name"] = "echo"
+	c.body = []byte(`{"b": 1}`)
+	server.callMethodV2(c)
+	var envelope struct {
+		Error APIError `json:"error"`
+	}
+	c.decode(t, &envelope)
+	if c.status != 400 || envelope.Error.Code != CodeInvalidRequest {
+		t.Fatalf("expected 400 for an invalid method input, got %d: %v", c.status, c.resp)
+	}
+	details, _ := envelope.Error.Details.([]any)
+	if len(details) != 1 || details[0].(map[string]any)["path"] != "/a" {
+		t.Errorf("expected the violation in the details, got %v", envelope.Error.Details)
+	}
+
+	c = newTestContext()
+	c.params["id"] = "demo"
+	c.params["name"] = "echo"
+	c.body = []byte(`{"a": 1}`)
+	server.callMethodV2(c)
+	if c.status != 500 {
+		t.Errorf("expected 500 for an output not matching its schema, got %d: %v", c.status, c.resp)
+	}
+
+	c = newTestContext()
+	c.params["id"] = "broken"
+	c.form["meta"] = `{"loader": "yaegi_http", "input_schema": {"type": 1}}`
+	c.body = []byte(testScript)
+	server.putPluginV2(c)
+	if c.status != 400 {
+		t.Errorf("expected 400 for an invalid schema, got %d: %v", c.status, c.resp)
+	}
+}
@@ -2,25 +2,73 @@ package goplugify
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
-	"fmt"
 	"io"
 	"mime/multipart"
-	"net/url"
 	"sync"
 )
 
 type HTTPServer struct {
-	pluginManagers PluginManagers
+	registry *Registry
+	jobs     *JobQueue
+
+	gatewayRoutes []*gatewayRoute
+	gatewayMounts []string
+	routes        []Route
+	headers       []string
+	maxBody       int64
+	batchURLs     bool
+	statusCodes   bool
+	lock          sync.RWMutex
+}
 
-	handlers map[string]Handler
-	lock     sync.RWMutex
+// Route describes a management route registered by the HTTPServer, it is the
+// source of the OpenAPI document.
+type Route struct {
+	Method  string
+	Path    string
+	Summary string
+	// Service is set on routes that select a plugin manager with the service query parameter.
+	Service bool
+	// Query lists the other required query parameters.
+	Query []string
+	// Params lists the optional query parameters.
+	Params []string
+	// Body is the request body kind, one of the RouteBody constants.
+	Body string
+	// Response names the schema of a successful response.
+	Response string
+	// ErrorFormat is the format of error responses, one of the ErrorFormat constants.
+	ErrorFormat string
+	Secured     bool
+	// Permissions are required by the Authorizer of the router, all of them.
+	Permissions []Permission
+	// ContentHash is set on the routes uploading artifacts, they require a signed
+	// X-Go-Plugify-Content-Hash when Secured. The verified hashes are passed on with
+	// HttpValueContext, or read again from the headers when the context lacks it.
+	ContentHash bool
+
+	handler Handler
+	// undocumented keeps the route out of Routes, such as the gateway mounts whose
+	// plugin routes are documented instead.
+	undocumented bool
 }
 
+const (
+	RouteBodyNone      = ""
+	RouteBodyJSON      = "json"
+	RouteBodyMultipart = "multipart"
+
+	ErrorFormatLegacy   = ""
+	ErrorFormatEnvelope = "envelope"
+)
+
 func InitHTTPServer(pluginManagers PluginManagers) *HTTPServer {
 	return &HTTPServer{
-		pluginManagers: pluginManagers,
-		handlers:       make(map[string]Handler),
+		registry: NewRegistry(pluginManagers),
+		jobs:     NewJobQueue(DefaultJobWorkers, DefaultJobQueueSize, DefaultJobTTL),
 	}
 }
 
@@ -42,72 +90,149 @@ type HttpContext interface {
 }
 
 func (server *HTTPServer) RegisterRoutes(router HttpRouter, routePrefix string) {
-	router.Add("POST", routePrefix+"/plugin/init", server.Init)
-	router.Add("POST", routePrefix+"/plugin/run", server.Run)
-	router.Add("POST", routePrefix+"/plugin/load", server.Load)
-	router.Add("GET", routePrefix+"/plugin/list", server.List)
-	router.Add("POST", routePrefix+"/plugin/unload", server.Unload)
-	router.Add("GET", routePrefix+"/plugin/components", server.Components)
-	router.Add("POST", routePrefix+"/plugin/gateway", server.Gateway)
+	server.addRoutes(router, routePrefix, []Route{
+		{Method: "POST", Path: "/plugin/init", Service: true, Summary: "Load a plugin and run it", Body: RouteBodyMultipart, Permissions: []Permission{PermLoad, PermRun}, ContentHash: true, handler: server.Init},
+		{Method: "POST", Path: "/plugin/run", Service: true, Summary: "Run a plugin, with async=true as a job", Query: []string{"plugin_id"}, Body: RouteBodyJSON, Permissions: []Permission{PermRun}, handler: server.Run},
+		{Method: "POST", Path: "/plugin/run/stream", Service: true, Summary: "Run a plugin streaming its events as Server-Sent Events or NDJSON", Query: []string{"plugin_id"}, Body: RouteBodyJSON, Permissions: []Permission{PermRun}, handler: server.RunStream},
+		{Method: "GET", Path: "/plugin/job", Service: true, Summary: "Get an asynchronous run", Query: []string{"id"}, Params: []string{"plugin_id"}, Response: "Job", Permissions: []Permission{PermRun}, handler: server.Job},
+		{Method: "POST", Path: "/plugin/job/cancel", Service: true, Summary: "Cancel an asynchronous run", Query: []string{"id"}, Params: []string{"plugin_id"}, Response: "Job", Permissions: []Permission{PermRun}, handler: server.CancelJob},
+		{Method: "GET", Path: "/plugin/jobs", Service: true, Summary: "List the asynchronous runs of a service", Params: []string{"plugin_id"}, Response: "JobList", Permissions: []Permission{PermRun}, handler: server.Jobs},
+		{Method: "POST", Path: "/plugin/load", Service: true, Summary: "Load or upgrade a plugin", Body: RouteBodyMultipart, Response: "Meta", Permissions: []Permission{PermLoad}, ContentHash: true, handler: server.Load},
+		{Method: "POST", Path: "/plugin/batch", Service: true, Summary: "Load and unload several plugins, all or none", Body: RouteBodyMultipart, Response: "MetaList", Permissions: []Permission{PermLoad, PermUnload}, ContentHash: true, handler: server.Batch},
+		{Method: "GET", Path: "/plugin/list", Service: true, Summary: "List plugins, paged with limit and cursor", Params: listParams, Response: "PluginList", Permissions: []Permission{PermList}, handler: server.List},
+		{Method: "GET", Path: "/plugin/get", Service: true, Summary: "Get a plugin with its exported methods", Query: []string{"plugin_id"}, Response: "PluginDetail", Permissions: []Permission{PermList}, handler: server.Get},
+		{Method: "POST", Path: "/plugin/unload", Service: true, Summary: "Unload a plugin", Query: []string{"plugin_id"}, Response: "Message", Permissions: []Permission{PermUnload}, handler: server.Unload},
+		{Method: "POST", Path: "/plugin/rollback", Service: true, Summary: "Restore the version a plugin had before its last upgrade", Query: []string{"plugin_id"}, Response: "Meta", Permissions: []Permission{PermLoad}, handler: server.Rollback},
+		{Method: "GET", Path: "/plugin/services", Summary: "List the services with their plugin count and loaders", Response: "ServiceList", Permissions: []Permission{PermList}, handler: server.Services},
+		{Method: "GET", Path: "/plugin/components", Service: true, Summary: "List the components plugins can use", Response: "PluginComponentItems", Permissions: []Permission{PermComponents}, handler: server.Components},
+		{Method: "POST", Path: "/plugin/gateway", Summary: "Call a handler registered by a plugin", Query: []string{"path"}, Body: RouteBodyJSON, Permissions: []Permission{PermRun}, handler: server.Gateway},
+		{Method: "GET", Path: "/openapi.json", Summary: "OpenAPI description of the registered routes", handler: server.OpenAPI},
+	})
 }
 
-func (server *HTTPServer) AddHandler(path string, handler Handler) {
+func (server *HTTPServer) addRoutes(router HttpRouter, routePrefix string, routes []Route) {
+	secured := isHMACRouter(router)
+	for _, route := range routes {
+		route.Path = routePrefix + route.Path
+		route.Secured = secured
+		if !route.undocumented {
+			server.documentRoute(route)
+		}
+		if route.ErrorFormat == ErrorFormatLegacy {
+			route.handler = server.withStatusCodes(route.handler)
+		}
+		if ar, ok := router.(*AuthHttpRouter); ok {
+			if route.ErrorFormat == ErrorFormatLegacy && ar.errorWriter == nil {
+				ar = ar.WithErrorWriter(server.errorRet).(*AuthHttpRouter)
+			}
+			ar.addRoute(route)
+			continue
+		}
+		router.Add(route.Method, route.Path, route.handler)
+	}
+}
+
+// documentRoute records route for Routes, replacing the one registered before with
+// the same method and path.
+func (server *HTTPServer) documentRoute(route Route) {
 	server.lock.Lock()
 	defer server.lock.Unlock()
-	server.handlers[path] = handler
+	for i, registered := range server.routes {
+		if registered.Method == route.Method && registered.Path == route.Path {
+			server.routes[i] = route
+			return
+		}
+	}
+	server.routes = append(server.routes, route)
 }
 
-func (server *HTTPServer) GetHandler(path string) (Handler, bool) {
+// Routes returns the management routes registered so far.
+func (server *HTTPServer) Routes() []Route {
 	server.lock.RLock()
 	defer server.lock.RUnlock()
-	h, ok := server.handlers[path]
-	return h, ok
+	return append([]Route(nil), server.routes...)
 }
 
 func (server *HTTPServer) Init(c HttpContext) {
 	plugin, err := server.loadPluginFromHTTP(c)
 	if err != nil {
-		ErrorRet(c, fmt.Errorf("load plugin error: %v", err))
+		ErrorRet(c, prefixError("load plugin error", err))
+		return
+	}
+	req, err := server.newRunRequest(c, server.getService(c), plugin, TriggerHTTP)
+	if err != nil {
+		ErrorRet(c, err)
 		return
 	}
-	resp, err := plugin.OnRun(c)
+	resp, err := plugin.OnRun(req)
 	if err != nil {
-		ErrorRet(c, fmt.Errorf("run plugin error: %v", err))
+		ErrorRet(c, WrapError(CodeRunFailed, "run", plugin.Meta().ID, err))
 		return
 	}
-	c.JSON(200, resp)
+	if err := writeRunResult(c, resp); err != nil {
+		ErrorRet(c, err)
+	}
 }
 
 func (server *HTTPServer) Run(c HttpContext) {
 	serviceName := server.getService(c)
+	manager, err := server.getManager(c)
+	if err != nil {
+		ErrorRet(c, err)
+		return
+	}
 
 	pluginID := c.Query("plugin_id")
 	if pluginID == "" {
-		ErrorRet(c, fmt.Errorf("plugin_id is required"))
+		ErrorRet(c, errMissingParam("plugin_id"))
 		return
 	}
 
-	plugin, err := server.pluginManagers[serviceName].GetPlugin(pluginID)
+	plugin, err := manager.GetPlugin(pluginID)
 	if err != nil {
-		ErrorRet(c, fmt.Errorf("get plugin error: %v", err))
+		ErrorRet(c, prefixError("get plugin error", err))
 		return
 	}
 
-	resp, err := plugin.OnRun(c)
+	trigger := TriggerHTTP
+	if c.Query("async") == "true" {
+		trigger = TriggerAsync
+	}
+	req, err := server.newRunRequest(c, serviceName, plugin, trigger)
 	if err != nil {
-		ErrorRet(c, fmt.Errorf("run plugin error: %v", err))
+		ErrorRet(c, err)
+		return
+	}
+
+	if trigger == TriggerAsync {
+		server.runAsync(c, req, plugin)
 		return
 	}
-	c.JSON(200, resp)
+
+	resp, err := plugin.OnRun(req)
+	if err != nil {
+		ErrorRet(c, WrapError(CodeRunFailed, "run", plugin.Meta().ID, err))
+		return
+	}
+	if err := writeRunResult(c, resp); err != nil {
+		ErrorRet(c, err)
+	}
 }
 
 func (server *HTTPServer) List(c HttpContext) {
-	serviceName := server.getService(c)
-	plugins := server.pluginManagers[serviceName].ListPlugins()
+	plugins, err := server.listPlugins(c)
+	if err != nil {
+		ErrorRet(c, err)
+		return
+	}
 	c.JSON(200, plugins)
 }
 
 func (server *HTTPServer) getService(c HttpContext) string {
+	return serviceOf(c)
+}
+
+func serviceOf(c HttpContext) string {
 	serviceName := c.Query("service")
 	if serviceName == "" {
 		serviceName = "default"
@@ -116,9 +241,13 @@ func (server *HTTPServer) getService(c HttpContext) string {
 }
 
 func (server *HTTPServer) Components(c HttpContext) {
-	serviceName := server.getService(c)
+	manager, err := server.getManager(c)
+	if err != nil {
+		ErrorRet(c, err)
+		return
+	}
 	comps := make(PluginComponentItems, 0)
-	for _, comp := range server.pluginManagers[serviceName].Components().Components {
+	for _, comp := range manager.Components().Components {
 		comps = append(comps, &PluginComponentItem{
 			Name:    comp.Name(),
 			PkgPath: GetPkgPathOfAny(comp),
@@ -126,11 +255,11 @@ func (server *HTTPServer) Components(c HttpContext) {
 	}
 	comps = append(comps, &PluginComponentItem{
 		Name:    "Logger",
-		PkgPath: GetPkgPathOfAny(server.pluginManagers[serviceName].Components().GetLogger()),
+		PkgPath: GetPkgPathOfAny(manager.Components().GetLogger()),
 	})
 	comps = append(comps, &PluginComponentItem{
 		Name:    "Util",
-		PkgPath: GetPkgPathOfAny(server.pluginManagers[serviceName].Components().GetUtil()),
+		PkgPath: GetPkgPathOfAny(manager.Components().GetUtil()),
 	})
 	c.JSON(200, comps)
 }
@@ -138,25 +267,28 @@ func (server *HTTPServer) Components(c HttpContext) {
 func (server *HTTPServer) Load(c HttpContext) {
 	plugin, err := server.loadPluginFromHTTP(c)
 	if err != nil {
-		ErrorRet(c, fmt.Errorf("load plugin error: %v", err))
+		ErrorRet(c, prefixError("load plugin error", err))
 		return
 	}
 	c.JSON(200, plugin.Meta())
 }
 
 func (server *HTTPServer) Unload(c HttpContext) {
-	serviceName := server.getService(c)
+	manager, err := server.getManager(c)
+	if err != nil {
+		ErrorRet(c, err)
+		return
+	}
 
 	pluginID := c.Query("plugin_id")
 	if pluginID == "" {
-		ErrorRet(c, fmt.Errorf("plugin_id is required"))
+		ErrorRet(c, errMissingParam("plugin_id"))
 		return
 	}
 
-	manager := server.pluginManagers[serviceName]
-	err := manager.UnloadPlugin(c, pluginID)
+	err = manager.UnloadPlugin(c, pluginID)
 	if err != nil {
-		ErrorRet(c, fmt.Errorf("unload plugin error: %v", err))
+		ErrorRet(c, prefixError("unload plugin error", err))
 		return
 	}
 	c.JSON(200, map[string]any{
@@ -164,47 +296,143 @@ func (server *HTTPServer) Unload(c HttpContext) {
 	})
 }
 
+func (server *HTTPServer) Rollback(c HttpContext) {
+	manager, err := server.getManager(c)
+	if err != nil {
+		ErrorRet(c, err)
+		return
+	}
+
+	pluginID := c.Query("plugin_id")
+	if pluginID == "" {
+		ErrorRet(c, errMissingParam("plugin_id"))
+		return
+	}
+
+	rollbacker, ok := manager.(Rollbacker)
+	if !ok {
+		ErrorRet(c, NewCodeError(CodeInvalidRequest, "rollback is not supported by the service"))
+		return
+	}
+	plugin, err := rollbacker.Rollback(c, pluginID)
+	if err != nil {
+		ErrorRet(c, prefixError("rollback plugin error", err))
+		return
+	}
+	c.JSON(200, plugin.Meta())
+}
+
 func (server *HTTPServer) loadPluginFromHTTP(c HttpContext) (IPlugin, error) {
-	serviceName := server.getService(c)
+	manager, err := server.getManager(c)
+	if err != nil {
+		return nil, err
+	}
 
-	metaJSON := c.PostForm("meta")
-	if metaJSON == "" {
-		return nil, fmt.Errorf("meta is required")
+	// Reject oversized uploads before the form (and with it the artifact) gets parsed.
+	if err := checkContentLength(c, MaxArtifactSize(manager)); err != nil {
+		return nil, err
 	}
-	var meta = new(Meta)
-	err := json.Unmarshal([]byte(metaJSON), meta)
+
+	meta, err := parseMeta(c)
 	if err != nil {
-		return nil, fmt.Errorf("invalid meta: %v", err)
+		return nil, err
 	}
 
-	plugin, err := server.pluginManagers[serviceName].LoadPlugin(c, meta, c)
+	plugin, err := manager.LoadPlugin(c, meta, c)
 	if err != nil {
 		return nil, err
 	}
 	return plugin, nil
 }
 
-func (server *HTTPServer) Gateway(c HttpContext) {
-
-	path := c.Query("path")
-	if path == "" {
-		ErrorRet(c, fmt.Errorf("path is required"))
-		return
+func parseMeta(c HttpContext) (*Meta, error) {
+	metaJSON, err := formValue(c, "meta")
+	if err != nil {
+		return nil, err
+	}
+	if metaJSON == "" {
+		return nil, errMissingParam("meta")
+	}
+	sum := sha256.Sum256([]byte(metaJSON))
+	if err := checkSignedField(c, MetaHashKey, "meta", hex.EncodeToString(sum[:])); err != nil {
+		return nil, err
+	}
+	var meta = new(Meta)
+	err = json.Unmarshal([]byte(metaJSON), meta)
+	if err != nil {
+		return nil, &PlugifyError{Code: CodeInvalidMeta, message: "invalid meta", Err: err}
 	}
+	return meta, nil
+}
 
-	escapedPath, _ := url.PathUnescape(path)
+// StatusCodesKey is set on the context of the routes of a server with status codes
+// enabled, see HTTPServer.SetStatusCodes.
+const StatusCodesKey = "go-plugify.status_codes"
 
-	handler, ok := server.GetHandler(escapedPath)
-	if !ok {
-		ErrorRet(c, fmt.Errorf("no handler for path: %s", path))
+// ErrorRet writes err in the format of the original routes, {"error": "..."}, with
+// the status of its ErrorCode when StatusCodesKey is set. Otherwise it answers 500,
+// but for 413 when err is too large and 400 when it lists schema violations.
+func ErrorRet(c HttpContext, err error) {
+	if enabled, _ := c.Value(StatusCodesKey).(bool); enabled {
+		StatusErrorRet(c, err)
 		return
 	}
+	c.JSON(legacyStatus(err), map[string]any{
+		"error": err.Error(),
+	})
+}
 
-	handler(c)
+// legacyStatus is the status of err on the original routes without status codes.
+func legacyStatus(err error) int {
+	if CodeOf(err) == CodeTooLarge {
+		return 413
+	}
+	if _, ok := DetailsOf(err).([]SchemaViolation); ok && CodeOf(err) == CodeInvalidRequest {
+		return 400
+	}
+	return 500
 }
 
-func ErrorRet(c HttpContext, err error) {
-	c.JSON(500, map[string]any{
+// StatusErrorRet is ErrorRet answering the status of the ErrorCode of err, such as
+// 404 for an unknown plugin.
+func StatusErrorRet(c HttpContext, err error) {
+	c.JSON(toAPIError(err).Status, map[string]any{
 		"error": err.Error(),
 	})
 }
+
+// SetStatusCodes makes the routes in the original error format, the ones of
+// RegisterRoutes, RegisterGateway, RegisterPluginUI and RegisterHealth, answer errors
+// with the status of their ErrorCode instead of 500, see ErrorRet. The v2 routes always
+// do. It needs a router whose contexts implement HttpValueContext.
+func (server *HTTPServer) SetStatusCodes(enabled bool) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.statusCodes = enabled
+}
+
+func (server *HTTPServer) statusCodesEnabled() bool {
+	server.lock.RLock()
+	defer server.lock.RUnlock()
+	return server.statusCodes
+}
+
+// withStatusCodes sets StatusCodesKey for handler while status codes are enabled.
+func (server *HTTPServer) withStatusCodes(handler Handler) Handler {
+	return func(c HttpContext) {
+		if vc, ok := c.(HttpValueContext); ok && server.statusCodesEnabled() {
+			vc.Set(StatusCodesKey, true)
+		}
+		handler(c)
+	}
+}
+
+// errorRet is the ErrorWriter of the routes in the original error format, for the
+// errors answered before withStatusCodes runs.
+func (server *HTTPServer) errorRet(c HttpContext, err error) {
+	if server.statusCodesEnabled() {
+		StatusErrorRet(c, err)
+		return
+	}
+	ErrorRet(c, err)
+}
@@ -0,0 +1,179 @@
+package goplugify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HttpStreamContext is implemented by contexts that can write a raw response and flush
+// it to the client while the handler is still running.
+type HttpStreamContext interface {
+	SetHeader(key, value string)
+	WriteHeader(code int)
+	Write(data []byte) (int, error)
+	Flush()
+}
+
+// Emitter lets a running plugin report progress and log lines to the caller.
+type Emitter interface {
+	Emit(event string, data any) error
+	Progress(percent float64, message string) error
+	Log(format string, args ...any) error
+}
+
+// EmitterContext is implemented by run inputs, RunRequest among them.
+type EmitterContext interface {
+	Emitter() Emitter
+}
+
+// EmitterOf returns the emitter of a streaming run input, or one that discards every
+// event when the plugin was not started in streaming mode.
+func EmitterOf(input any) Emitter {
+	if ec, ok := input.(EmitterContext); ok {
+		return ec.Emitter()
+	}
+	return nopEmitter{}
+}
+
+type nopEmitter struct{}
+
+func (nopEmitter) Emit(event string, data any) error              { return nil }
+func (nopEmitter) Progress(percent float64, message string) error { return nil }
+func (nopEmitter) Log(format string, args ...any) error           { return nil }
+
+const (
+	StreamFormatSSE    = "sse"
+	StreamFormatNDJSON = "ndjson"
+)
+
+type ProgressEvent struct {
+	Percent float64 `json:"percent"`
+	Message string  `json:"message,omitempty"`
+}
+
+type LogEvent struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// streamEmitter writes events to the response as Server-Sent Events or NDJSON.
+type streamEmitter struct {
+	w      HttpStreamContext
+	format string
+	// cancel stops the run once a write fails, the client is gone.
+	cancel context.CancelFunc
+	err    error
+	seq    int
+	lock   sync.Mutex
+}
+
+func (e *streamEmitter) Emit(event string, data any) error {
+	// A line break would end the event field and let the name inject SSE fields.
+	if strings.ContainsAny(event, "\r\n") {
+		return fmt.Errorf("invalid event name %q", event)
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.err != nil {
+		return e.err
+	}
+	e.seq++
+	var frame string
+	if e.format == StreamFormatNDJSON {
+		frame = fmt.Sprintf("{\"event\":%q,\"id\":%d,\"data\":%s}\n", event, e.seq, payload)
+	} else {
+		frame = fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", e.seq, event, payload)
+	}
+	if _, err := e.w.Write([]byte(frame)); err != nil {
+		e.err = err
+		if e.cancel != nil {
+			e.cancel()
+		}
+		return err
+	}
+	e.w.Flush()
+	return nil
+}
+
+func (e *streamEmitter) Progress(percent float64, message string) error {
+	return e.Emit("progress", ProgressEvent{Percent: percent, Message: message})
+}
+
+func (e *streamEmitter) Log(format string, args ...any) error {
+	return e.Emit("log", LogEvent{Time: time.Now(), Message: fmt.Sprintf(format, args...)})
+}
+
+func streamFormat(c HttpContext) string {
+	format := c.Query("format")
+	if format == "" && strings.Contains(c.GetHeader("Accept"), "application/x-ndjson") {
+		format = StreamFormatNDJSON
+	}
+	if format != StreamFormatNDJSON {
+		format = StreamFormatSSE
+	}
+	return format
+}
+
+// RunStream runs a plugin and relays the events it emits as Server-Sent Events, or as
+// NDJSON with format=ndjson. The stream ends with a "result" or an "error" event. The
+// context of the run is canceled once an event cannot be written.
+func (server *HTTPServer) RunStream(c HttpContext) {
+	sc, ok := c.(HttpStreamContext)
+	if !ok {
+		ErrorRet(c, NewCodeError(CodeInvalidRequest, "streaming is not supported by the http router"))
+		return
+	}
+
+	manager, err := server.getManager(c)
+	if err != nil {
+		ErrorRet(c, err)
+		return
+	}
+	pluginID := c.Query("plugin_id")
+	if pluginID == "" {
+		ErrorRet(c, errMissingParam("plugin_id"))
+		return
+	}
+	plugin, err := manager.GetPlugin(pluginID)
+	if err != nil {
+		ErrorRet(c, prefixError("get plugin error", err))
+		return
+	}
+	req, err := server.newRunRequest(c, server.getService(c), plugin, TriggerStream)
+	if err != nil {
+		ErrorRet(c, err)
+		return
+	}
+
+	format := streamFormat(c)
+	if format == StreamFormatNDJSON {
+		sc.SetHeader("Content-Type", "application/x-ndjson")
+	} else {
+		sc.SetHeader("Content-Type", "text/event-stream")
+	}
+	sc.SetHeader("Cache-Control", "no-cache")
+	sc.SetHeader("X-Accel-Buffering", "no")
+	sc.WriteHeader(200)
+	sc.Flush()
+
+	ctx, cancel := context.WithCancel(req.Context)
+	defer cancel()
+	req.Context = ctx
+	emitter := &streamEmitter{w: sc, format: format, cancel: cancel}
+	req.emitter = emitter
+	resp, err := plugin.OnRun(req)
+	if err != nil {
+		emitter.Emit("error", toAPIError(WrapError(CodeRunFailed, "run", pluginID, err)))
+		return
+	}
+	emitter.Emit("result", resp)
+}
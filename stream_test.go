@@ -0,0 +1,115 @@
+package goplugify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testStreamContext struct {
+	*testContext
+	header map[string]string
+	out    bytes.Buffer
+}
+
+func (c *testStreamContext) SetHeader(key, value string)    { c.header[key] = value }
+func (c *testStreamContext) WriteHeader(code int)           { c.status = code }
+func (c *testStreamContext) Write(data []byte) (int, error) { return c.out.Write(data) }
+func (c *testStreamContext) Flush()                         {}
+
+const testStreamScript = `package main
+
+import "plugify/plugify"
+
+func Run(input map[string]any) (any, error) {
+	emitter := input["emitter"].(plugify.Emitter)
+	emitter.Progress(50, "half way")
+	emitter.Log("processed %d rows", 10)
+	return map[string]any{"rows": 10}, nil
+}
+
+func Methods() map[string]func(any) any {
+	return map[string]func(any) any{}
+}
+
+func Destroy(input map[string]any) error {
+	return nil
+}
+`
+
+func TestRunStream(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	c := newTestContext()
+	c.params["id"] = "backfill"
+	c.form["meta"] = `{"loader": "yaegi_http"}`
+	c.body = []byte(testStreamScript)
+	server.putPluginV2(c)
+	if c.status != 201 {
+		t.Fatalf("load plugin: %d %v", c.status, c.resp)
+	}
+
+	for _, format := range []string{StreamFormatSSE, StreamFormatNDJSON} {
+		sc := &testStreamContext{testContext: newTestContext(), header: map[string]string{}}
+		sc.query["plugin_id"] = "backfill"
+		sc.query["format"] = format
+		server.RunStream(sc)
+
+		out := sc.out.String()
+		var want []string
+		if format == StreamFormatSSE {
+			want = []string{
+				"id: 1\nevent: progress\ndata: {\"percent\":50,\"message\":\"half way\"}\n\n",
+				"event: log\ndata: {\"time\":",
+				"processed 10 rows",
+				"id: 3\nevent: result\ndata: {\"rows\":10}\n\n",
+			}
+		} else {
+			want = []string{
+				`{"event":"progress","id":1,"data":{"percent":50,"message":"half way"}}` + "\n",
+				`{"event":"result","id":3,"data":{"rows":10}}` + "\n",
+			}
+		}
+		for _, w := range want {
+			if !strings.Contains(out, w) {
+				t.Errorf("%s stream missing %q, got:\n%s", format, w, out)
+			}
+		}
+	}
+
+	sc := &testStreamContext{testContext: newStatusTestContext(), header: map[string]string{}}
+	sc.query["plugin_id"] = "missing"
+	server.RunStream(sc)
+	if sc.status != 404 || sc.out.Len() != 0 {
+		t.Errorf("expected a plain 404 before the stream starts, got %d %q", sc.status, sc.out.String())
+	}
+}
+
+type failingStreamContext struct {
+	testStreamContext
+	writes int
+}
+
+func (c *failingStreamContext) Write(data []byte) (int, error) {
+	c.writes++
+	return 0, errors.New("client gone")
+}
+
+func TestStreamEmitter(t *testing.T) {
+	sc := &testStreamContext{testContext: newTestContext(), header: map[string]string{}}
+	emitter := &streamEmitter{w: sc, format: StreamFormatSSE}
+	if err := emitter.Emit("done\ndata: {}\n\nevent: forged", 1); err == nil || sc.out.Len() != 0 {
+		t.Errorf("expected an event name with line breaks to be rejected, got %v %q", err, sc.out.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	failing := &failingStreamContext{testStreamContext: *sc}
+	emitter = &streamEmitter{w: failing, format: StreamFormatSSE, cancel: cancel}
+	if err := emitter.Progress(10, ""); err == nil || ctx.Err() == nil {
+		t.Fatalf("expected a failed write to cancel the run, got %v", err)
+	}
+	if err := emitter.Log("more"); err == nil || failing.writes != 1 {
+		t.Errorf("expected no write once the client is gone, got %v after %d writes", err, failing.writes)
+	}
+}
@@ -0,0 +1,145 @@
+package goplugify
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// AssetsProvider is implemented by plugins that ship UI assets. Native plugins
+// implement it on their exported PluginFunc, yaegi scripts define an Assets function.
+type AssetsProvider interface {
+	Assets() fs.FS
+}
+
+// assetsOf returns the assets of a native plugin export, nil when it has none.
+func assetsOf(exports any) fs.FS {
+	if provider, ok := exports.(AssetsProvider); ok {
+		return provider.Assets()
+	}
+	return nil
+}
+
+// withAssetsBundle attaches the assets bundle uploaded along with the artifact.
+func withAssetsBundle(plugin IPlugin, c HttpContext, limit int64) (IPlugin, error) {
+	assets, err := openAssetsBundle(c, limit)
+	if err != nil || assets == nil {
+		return plugin, err
+	}
+	if p, ok := plugin.(interface{ setAssets(fs.FS) }); ok {
+		p.setAssets(assets)
+	}
+	return plugin, nil
+}
+
+// openAssetsBundle reads the zip archive of the "assets" form field of a multipart
+// upload, nil when the upload has none.
+func openAssetsBundle(c HttpContext, limit int64) (fs.FS, error) {
+	if !strings.Contains(c.GetHeader("Content-Type"), "multipart/form-data") {
+		return nil, nil
+	}
+	file, err := c.FormFile("assets")
+	if errors.Is(err, http.ErrMissingFile) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("assets error: %v", err)
+	}
+	if limit > 0 && file.Size > limit {
+		return nil, fmt.Errorf("%w: assets of %d bytes exceed %d", ErrArtifactTooLarge, file.Size, limit)
+	}
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, sum, err := readArtifact(f, limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSignedField(c, AssetsHashKey, "assets", sum); err != nil {
+		return nil, err
+	}
+	bundle, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, &PlugifyError{Code: CodeInvalidPlugin, message: "invalid assets bundle", Err: err}
+	}
+	return bundle, nil
+}
+
+// RegisterPluginUI serves the assets of each plugin under {routePrefix}/plugin/ui/{id}/,
+// from the default service or the one of the service query parameter. Browsers do
+// not sign the pages they navigate to, so router is usually not authenticated and
+// plugin pages call the management routes the way the console does. Pages are
+// sandboxed in an opaque origin, so a plugin cannot reach the console's storage or
+// make same-origin calls on behalf of its users.
+func (server *HTTPServer) RegisterPluginUI(router HttpRouter, routePrefix string) {
+	server.addRoutes(router, routePrefix, []Route{
+		{Method: "GET", Path: "/plugin/ui/:id/*path", Service: true, Permissions: []Permission{PermList}, undocumented: true, handler: server.PluginUI},
+	})
+}
+
+// pluginUIPolicy sandboxes plugin pages without allow-same-origin, and keeps them
+// from framing or being framed by the console.
+const pluginUIPolicy = "sandbox allow-scripts allow-forms allow-popups; frame-ancestors 'none'"
+
+func (server *HTTPServer) PluginUI(c HttpContext) {
+	sc, ok := c.(HttpStreamContext)
+	if !ok {
+		ErrorRet(c, NewCodeError(CodeInvalidRequest, "serving plugin assets is not supported by the http router"))
+		return
+	}
+	plugin, err := server.getPluginOfPath(c)
+	if err != nil {
+		ErrorRet(c, err)
+		return
+	}
+	provider, ok := plugin.(AssetsProvider)
+	var assets fs.FS
+	if ok {
+		assets = provider.Assets()
+	}
+	if assets == nil {
+		ErrorRet(c, NewCodeError(CodeNotFound, fmt.Sprintf("plugin %s has no ui", plugin.Meta().ID)))
+		return
+	}
+
+	name := strings.Trim(path.Clean("/"+PathParam(c, "path")), "/")
+	if name == "" {
+		name = "."
+	}
+	if info, err := fs.Stat(assets, name); err == nil && info.IsDir() {
+		name = path.Join(name, "index.html")
+	}
+	data, err := fs.ReadFile(assets, name)
+	if err != nil {
+		ErrorRet(c, NewCodeError(CodeNotFound, fmt.Sprintf("asset %s not found", name)))
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	// Assets change with every upgrade, the ETag ties them to the plugin version.
+	sum := sha256.Sum256(data)
+	etag := fmt.Sprintf(`"%s-%x"`, plugin.Meta().Version, sum[:8])
+	sc.SetHeader("ETag", etag)
+	sc.SetHeader("Cache-Control", "no-cache")
+	sc.SetHeader("Content-Security-Policy", pluginUIPolicy)
+	sc.SetHeader("X-Content-Type-Options", "nosniff")
+	if c.GetHeader("If-None-Match") == etag {
+		sc.WriteHeader(304)
+		return
+	}
+	sc.SetHeader("Content-Type", contentType)
+	sc.WriteHeader(200)
+	sc.Write(data)
+}
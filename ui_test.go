@@ -0,0 +1,121 @@
+package goplugify
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testAssetsScript = `package main
+
+import "testing/fstest"
+import "io/fs"
+
+func Run(input map[string]any) (any, error) { return "ran", nil }
+
+func Methods() map[string]func(any) any { return nil }
+
+func Destroy(input map[string]any) error { return nil }
+
+func Assets() fs.FS {
+	return fstest.MapFS{"index.html": &fstest.MapFile{Data: []byte("<h1>script ui</h1>")}}
+}
+`
+
+func uploadWithAssets(t *testing.T, url, id, script string, assets map[string]string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("meta", `{"id": "`+id+`", "loader": "yaegi_http", "version": "v1"}`)
+	fw, _ := mw.CreateFormFile("file", "plugin.go")
+	fw.Write([]byte(script))
+	if assets != nil {
+		aw, _ := mw.CreateFormFile("assets", "assets.zip")
+		zw := zip.NewWriter(aw)
+		for name, content := range assets {
+			w, _ := zw.Create(name)
+			w.Write([]byte(content))
+		}
+		zw.Close()
+	}
+	mw.Close()
+	resp, err := http.Post(url+"/api/plugin/load", mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("load %s: %d %s", id, resp.StatusCode, data)
+	}
+}
+
+func getUI(t *testing.T, url string, header map[string]string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	return resp, string(data)
+}
+
+func TestPluginUI(t *testing.T) {
+	server := InitHTTPServer(InitPluginManagers("default"))
+	server.SetStatusCodes(true)
+	router := NewServeMuxRouter(nil)
+	server.RegisterRoutes(router, "/api")
+	server.RegisterPluginUI(router, "/api")
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	uploadWithAssets(t, ts.URL, "bundle", testScript, map[string]string{
+		"index.html":    "<h1>bundle ui</h1>",
+		"static/app.js": "console.log(1)",
+	})
+	resp, body := getUI(t, ts.URL+"/api/plugin/ui/bundle/", nil)
+	if resp.StatusCode != 200 || body != "<h1>bundle ui</h1>" || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("unexpected index %d %s %q", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+	if csp := resp.Header.Get("Content-Security-Policy"); !strings.HasPrefix(csp, "sandbox") || strings.Contains(csp, "allow-same-origin") {
+		t.Errorf("expected plugin pages to be sandboxed in an opaque origin, got %q", csp)
+	}
+	resp, _ = getUI(t, ts.URL+"/api/plugin/ui/bundle/static/app.js", map[string]string{"If-None-Match": resp.Header.Get("ETag")})
+	if resp.StatusCode != 200 {
+		t.Errorf("expected the script asset, got %d", resp.StatusCode)
+	}
+	etag := resp.Header.Get("ETag")
+	resp, _ = getUI(t, ts.URL+"/api/plugin/ui/bundle/static/app.js", map[string]string{"If-None-Match": etag})
+	if resp.StatusCode != 304 {
+		t.Errorf("expected 304 for a matching ETag, got %d", resp.StatusCode)
+	}
+
+	uploadWithAssets(t, ts.URL, "script", testAssetsScript, nil)
+	if resp, body := getUI(t, ts.URL+"/api/plugin/ui/script/", nil); resp.StatusCode != 200 || body != "<h1>script ui</h1>" {
+		t.Errorf("unexpected script assets %d %q", resp.StatusCode, body)
+	}
+
+	// A version without assets drops the ones of the previous version.
+	uploadWithAssets(t, ts.URL, "bundle", testScript, nil)
+	if resp, _ := getUI(t, ts.URL+"/api/plugin/ui/bundle/", nil); resp.StatusCode != 404 {
+		t.Errorf("expected 404 after an upgrade without assets, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest("POST", ts.URL+"/api/plugin/unload?plugin_id=script", nil)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("unload: %v %v", resp, err)
+	}
+	if resp, _ := getUI(t, ts.URL+"/api/plugin/ui/script/", nil); resp.StatusCode != 404 {
+		t.Errorf("expected 404 after unload, got %d", resp.StatusCode)
+	}
+}